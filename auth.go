@@ -1,12 +1,14 @@
 package proxmox
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 // AuthTicketResponse is the response from the Proxmox API after a successful auth
@@ -24,61 +26,213 @@ type AuthResponse struct {
 	Ticket    string `json:"ticket"`
 }
 
-// SignIn will signin the user and update the embedded client with the ticket
+// Proxmox tickets are valid for two hours. They are renewed well before that
+// so that a slow request never goes out with a ticket about to expire
+const (
+	ticketLifetime   = 2 * time.Hour
+	ticketRenewAfter = 90 * time.Minute
+)
+
+// SignIn will signin the user and update the embedded client with the ticket.
+// Clients using an API token have no ticket, so this is a no-op for them
 func (c *Client) SignIn() error {
-	log.WithFields(logrus.Fields{
+	return c.SignInContext(context.Background())
+}
+
+// SignInContext is SignIn with a context for cancellation and deadlines
+func (c *Client) SignInContext(ctx context.Context) error {
+	if c.usesToken() {
+		return nil
+	}
+
+	c.debug("Signing into Proxmox", Fields{
 		"username": c.username,
-		"password": c.password,
-	}).Debugln("Signing into Proxmox")
+	})
 
+	err := c.requestTicket(ctx, c.password)
+	if err != nil {
+		return err
+	}
+
+	c.debug("Successfully signed into Proxmox", nil)
+	return nil
+}
+
+// requestTicket posts to the ticket endpoint and stores the resulting ticket.
+// The password is either the user's password or, to renew, the current ticket
+func (c *Client) requestTicket(ctx context.Context, password string) error {
 	u, err := url.Parse(c.host + "/api2/json/access/ticket")
 	if err != nil {
 		return errors.Wrap(err, "Could not parse URL")
 	}
 
-	resp, err := c.client.PostForm(u.String(), url.Values{
+	form := url.Values{
 		"username": []string{c.username},
-		"password": []string{c.password},
-	})
+		"password": []string{password},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "Could not create request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "Could not POST form to proxmox ticket endpoint")
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(newAPIError(resp), "Could not auth")
+	}
 
 	authResponse := &AuthTicketResponse{}
+	err = DecodeJSON(resp.Body, authResponse)
+	if err != nil {
+		return err
+	}
 
-	MustDecodeJSON(resp.Body, authResponse)
+	c.mu.Lock()
 	c.CSRFToken = authResponse.Data.CSRFPreventionToken
 	c.Ticket = authResponse.Data.Ticket
+	c.ticketIssued = time.Now()
+	c.mu.Unlock()
 
 	proxmoxCookie := &http.Cookie{
 		Name:   "PVEAuthCookie",
-		Value:  c.Ticket,
-		Domain: proxmoxDomain,
+		Value:  authResponse.Data.Ticket,
+		Domain: c.cookieDomain,
 		Path:   "/",
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		err := fmt.Sprintf("Could not auth: %s", resp.Status)
-		return errors.New(err)
-	}
-
 	c.client.Jar.SetCookies(u, []*http.Cookie{proxmoxCookie})
-	log.Debugln("Successfully signed into Proxmox")
 	return nil
 }
 
+// renewTicket exchanges the current ticket for a fresh one, falling back to a
+// full sign in if the ticket has already expired or the renewal is refused
+func (c *Client) renewTicket(ctx context.Context) error {
+	c.mu.Lock()
+	ticket := c.Ticket
+	issued := c.ticketIssued
+	c.mu.Unlock()
+
+	if ticket != "" && time.Since(issued) < ticketLifetime {
+		c.debug("Renewing Proxmox ticket", nil)
+		err := c.requestTicket(ctx, ticket)
+		if err == nil {
+			return nil
+		}
+		c.debug("Could not renew ticket, signing in again", Fields{"error": err})
+	}
+
+	return c.SignInContext(ctx)
+}
+
 // VerifyTicket confirms that the currently held ticket in the client is valid
 func (c *Client) VerifyTicket() (bool, error) {
-	log.Debugln("Checking Proxmox auth")
+	return c.VerifyTicketContext(context.Background())
+}
+
+// VerifyTicketContext is VerifyTicket with a context for cancellation and deadlines
+func (c *Client) VerifyTicketContext(ctx context.Context) (bool, error) {
+	c.debug("Checking Proxmox auth", nil)
 	u, err := url.Parse(c.host + "/api2/json/version")
 	if err != nil {
 		return false, errors.Wrap(err, "Could not parse URL")
 	}
 
-	resp, err := c.client.Get(u.String())
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("Could not do auth check: %s", resp.Status)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return false, errors.Wrap(err, "Could not create request")
+	}
+
+	c.authorize(req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "Could not execute request")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized:
+		return false, nil
+	default:
+		return false, errors.Wrap(newAPIError(resp), "Could not do auth check")
+	}
+}
+
+// usesToken reports whether the client authenticates with an API token rather than a ticket
+func (c *Client) usesToken() bool {
+	return c.tokenID != ""
+}
+
+// ensureAuth renews the held ticket once it is close to expiry.
+// API tokens do not expire, so there is nothing to do for them
+func (c *Client) ensureAuth(ctx context.Context) error {
+	if c.usesToken() {
+		return nil
+	}
+
+	c.mu.Lock()
+	stale := time.Since(c.ticketIssued) > ticketRenewAfter
+	c.mu.Unlock()
+
+	if stale {
+		return c.renewTicket(ctx)
+	}
+	return nil
+}
+
+// authorize attaches the credentials for the client's auth mode to the request.
+// Tickets travel in the cookie jar, so only the CSRF token is needed for writes
+func (c *Client) authorize(req *http.Request) {
+	if c.usesToken() {
+		req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s=%s", c.tokenID, c.tokenSecret))
+		return
+	}
+
+	if req.Method != "GET" {
+		c.mu.Lock()
+		req.Header.Set("CSRFPreventionToken", c.CSRFToken)
+		c.mu.Unlock()
+	}
+}
+
+// do executes the request against the Proxmox API with the client's credentials.
+// If Proxmox rejects the ticket anyway (e.g. it was revoked or the node restarted)
+// the client signs in again and retries the request once
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	err := c.ensureAuth(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	c.authorize(req)
+	resp, err := c.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.usesToken() {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	c.debug("Proxmox rejected the ticket, signing in again", nil)
+	err = c.SignInContext(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return nil, errors.New("Could not replay request body after signing in again")
+		}
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not replay request body")
+		}
 	}
 
-	return true, nil
+	c.authorize(req)
+	return c.client.Do(req)
 }
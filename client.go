@@ -3,20 +3,20 @@
 package proxmox
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/blockninja/proxmox-client/logger"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
-var log *logrus.Logger
-
 // Client contains the state for the proxmox client
 type Client struct {
 	CSRFToken string
@@ -25,26 +25,44 @@ type Client struct {
 	client    *http.Client
 	username  string
 	password  string
+
+	tokenID     string
+	tokenSecret string
+
+	mu           sync.Mutex
+	ticketIssued time.Time
+
+	cookieDomain     string
+	containerStorage string
+	vmStorage        string
+	templateStorage  string
+	isoStorage       string
+	defaultSwap      int
+	defaultBridge    string
+	defaultTag       int
+	placer           Placer
+	nodeTags         map[string][]string
+
+	tls         *tls.Config
+	fingerprint string
+	transport   http.RoundTripper
+
+	logger Logger
 }
 
 // New returns a new Proxmox client
-func New(host, username, password string) (*Client, error) {
-	log = logger.Get()
-	jar, err := cookiejar.New(nil)
+func New(host, username, password string, opts ...Option) (*Client, error) {
+	client, err := newHTTPClient()
 	if err != nil {
-		return nil, errors.Wrap(err, "Could not create cookie jar")
-	}
-
-	client := &http.Client{
-		Timeout: time.Second * 10,
+		return nil, err
 	}
-	client.Jar = jar
 	result := &Client{
 		username: username,
 		password: password,
 		host:     host,
 		client:   client,
 	}
+	result.applyOptions(opts)
 
 	err = result.SignIn()
 	if err != nil {
@@ -54,35 +72,130 @@ func New(host, username, password string) (*Client, error) {
 	return result, nil
 }
 
-// NextID returns the next available VMID
-func (c *Client) NextID() (int, error) {
-	authed, err := c.VerifyTicket()
+// NewWithToken returns a new Proxmox client that authenticates with an API token
+// instead of a ticket. tokenID is the full token ID, e.g. user@pam!automation
+func NewWithToken(host, tokenID, secret string, opts ...Option) (*Client, error) {
+	client, err := newHTTPClient()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	result := &Client{
+		tokenID:     tokenID,
+		tokenSecret: secret,
+		host:        host,
+		client:      client,
 	}
+	result.applyOptions(opts)
+
+	return result, nil
+}
+
+// applyOptions sets the defaults and then applies the options over them
+func (c *Client) applyOptions(opts []Option) {
+	c.logger = nopLogger{}
+	c.containerStorage = defaultContainerStorage
+	c.vmStorage = defaultVMStorage
+	c.templateStorage = defaultTemplateStorage
+	c.isoStorage = defaultISOStorage
+	c.defaultSwap = defaultSwap
+	c.defaultBridge = defaultBridge
+	c.placer = MostFreeMemory{}
 
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return 0, err
-		}
+	for _, opt := range opts {
+		opt(c)
 	}
+	c.client.Transport = c.roundTripper()
+}
 
-	u, err := url.Parse(fmt.Sprintf("%s/api2/json/cluster/nextid", c.host))
+func newHTTPClient() (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
 	if err != nil {
-		return 0, err
+		return nil, errors.Wrap(err, "Could not create cookie jar")
 	}
-	log.Debugln("Getting next available ID")
 
-	proxmoxAPIResp, err := c.client.Get(u.String())
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	client.Jar = jar
+	return client, nil
+}
+
+// Do sends a request to the Proxmox API and decodes the data field of the response into out,
+// which may be nil. path is relative to /api2/json, e.g. /nodes/pve1/status. params are sent
+// in the query string for GET and DELETE and as a form encoded body for POST and PUT.
+// Failed requests return an *APIError
+func (c *Client) Do(ctx context.Context, method, path string, params url.Values, out interface{}) error {
+	c.debug("Sending request to Proxmox", Fields{
+		"method": method,
+		"path":   path,
+		"params": redactValues(params),
+	})
+
+	u, err := url.Parse(c.host + "/api2/json" + path)
+	if err != nil {
+		return errors.Wrap(err, "Could not parse URL")
+	}
+
+	var body io.Reader
+	if method == "POST" || method == "PUT" {
+		body = strings.NewReader(params.Encode())
+	} else if len(params) > 0 {
+		u.RawQuery = params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return errors.Wrap(err, "Could not create request")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return errors.Wrap(err, "Could not execute request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// dump puts a copy of the body back for newAPIError to read
+		c.dump(resp)
+		return newAPIError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+
+	result := &struct {
+		Data interface{} `json:"data"`
+	}{Data: out}
+	return DecodeJSON(resp.Body, result)
+}
+
+// doTask sends a request that starts a worker task and returns the task's UPID
+func (c *Client) doTask(ctx context.Context, method, path string, params url.Values) (*UPID, error) {
+	var upid string
+	err := c.Do(ctx, method, path, params, &upid)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	if proxmoxAPIResp.StatusCode != http.StatusOK {
-		err := fmt.Sprintf("Could not get next ID: %s", proxmoxAPIResp.Status)
-		return 0, errors.New(err)
+	return ParseUPID(upid)
+}
+
+// NextID returns the next available VMID. Concurrent callers can get the same ID,
+// use a VMIDAllocator to hand out IDs to several workers
+func (c *Client) NextID() (int, error) {
+	return c.NextIDContext(context.Background())
+}
+
+// NextIDContext is NextID with a context for cancellation and deadlines
+func (c *Client) NextIDContext(ctx context.Context) (int, error) {
+	c.debug("Getting next available ID", nil)
+
+	var result string
+	err := c.Do(ctx, "GET", "/cluster/nextid", nil, &result)
+	if err != nil {
+		return 0, errors.Wrap(err, "Could not get next ID")
 	}
-	result := &NextIDResponse{}
-	MustDecodeJSON(proxmoxAPIResp.Body, result)
-	return strconv.Atoi(result.Data)
+	return strconv.Atoi(result)
 }
@@ -0,0 +1,21 @@
+package proxmox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient returns a client for a fake Proxmox API served by the handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewWithToken(server.URL, "root@pam!test", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
@@ -0,0 +1,159 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ContainerCloneRequest is a request to the Proxmox API to clone a container or container template
+type ContainerCloneRequest struct {
+	Node  string
+	VMID  int
+	NewID int
+	// Target is the node to create the clone on. Defaults to the source's node
+	Target string
+	// Storage is where a full clone's volumes go. Defaults to the source's storage
+	Storage     string
+	HostName    string
+	Description string
+	Pool        string
+	// Snapshot clones the container as it was in the named snapshot instead of its current state
+	Snapshot string
+	// Linked makes a linked clone that shares the source's volumes. The source must be a template
+	Linked bool
+	// BandwidthLimit is in KiB/s
+	BandwidthLimit int
+}
+
+// VMCloneRequest is a request to the Proxmox API to clone a VM or VM template
+type VMCloneRequest struct {
+	Node  string
+	VMID  int
+	NewID int
+	// Target is the node to create the clone on. Defaults to the source's node
+	Target string
+	// Storage and Format are where and how a full clone's disks are stored.
+	// They default to the source's storage and format
+	Storage     string
+	Format      string
+	Name        string
+	Description string
+	Pool        string
+	// Snapshot clones the VM as it was in the named snapshot instead of its current state
+	Snapshot string
+	// Linked makes a linked clone that shares the source's disks. The source must be a template
+	Linked bool
+	// BandwidthLimit is in KiB/s
+	BandwidthLimit int
+}
+
+// ConvertToTemplateRequest is a request to the Proxmox API to turn a guest into a template
+type ConvertToTemplateRequest struct {
+	// Type is GuestTypeContainer or GuestTypeVM
+	Type string
+	Node string
+	VMID int
+}
+
+// ContainerClone copies a container to NewID
+func (c *Client) ContainerClone(params *ContainerCloneRequest) (*UPID, error) {
+	return c.ContainerCloneContext(context.Background(), params)
+}
+
+// ContainerCloneContext is ContainerClone with a context for cancellation and deadlines
+func (c *Client) ContainerCloneContext(ctx context.Context, params *ContainerCloneRequest) (*UPID, error) {
+	c.debug("Cloning container", Fields{
+		"node":     params.Node,
+		"vmid":     params.VMID,
+		"newid":    params.NewID,
+		"target":   params.Target,
+		"snapshot": params.Snapshot,
+		"linked":   params.Linked,
+	})
+
+	p := requestParams{}
+	p.setInt("newid", params.NewID)
+	p.setString("target", params.Target)
+	p.setString("storage", params.Storage)
+	p.setString("hostname", params.HostName)
+	p.setString("description", params.Description)
+	p.setString("pool", params.Pool)
+	p.setString("snapname", params.Snapshot)
+	full := !params.Linked
+	p.setOptionalBool("full", &full)
+	p.setInt("bwlimit", params.BandwidthLimit)
+
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("/nodes/%s/lxc/%d/clone", params.Node, params.VMID), p.values())
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not clone container")
+	}
+	return upid, nil
+}
+
+// VMClone copies a VM to NewID
+func (c *Client) VMClone(params *VMCloneRequest) (*UPID, error) {
+	return c.VMCloneContext(context.Background(), params)
+}
+
+// VMCloneContext is VMClone with a context for cancellation and deadlines
+func (c *Client) VMCloneContext(ctx context.Context, params *VMCloneRequest) (*UPID, error) {
+	c.debug("Cloning VM", Fields{
+		"node":     params.Node,
+		"vmid":     params.VMID,
+		"newid":    params.NewID,
+		"target":   params.Target,
+		"snapshot": params.Snapshot,
+		"linked":   params.Linked,
+	})
+
+	p := requestParams{}
+	p.setInt("newid", params.NewID)
+	p.setString("target", params.Target)
+	p.setString("storage", params.Storage)
+	p.setString("format", params.Format)
+	p.setString("name", params.Name)
+	p.setString("description", params.Description)
+	p.setString("pool", params.Pool)
+	p.setString("snapname", params.Snapshot)
+	full := !params.Linked
+	p.setOptionalBool("full", &full)
+	p.setInt("bwlimit", params.BandwidthLimit)
+
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("/nodes/%s/qemu/%d/clone", params.Node, params.VMID), p.values())
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not clone VM")
+	}
+	return upid, nil
+}
+
+// ConvertToTemplate turns a stopped guest into a template that can be linked cloned.
+// Containers are converted before the call returns, so the UPID is nil for them
+func (c *Client) ConvertToTemplate(params *ConvertToTemplateRequest) (*UPID, error) {
+	return c.ConvertToTemplateContext(context.Background(), params)
+}
+
+// ConvertToTemplateContext is ConvertToTemplate with a context for cancellation and deadlines
+func (c *Client) ConvertToTemplateContext(ctx context.Context, params *ConvertToTemplateRequest) (*UPID, error) {
+	c.debug("Converting guest to template", Fields{
+		"type": params.Type,
+		"node": params.Node,
+		"vmid": params.VMID,
+	})
+
+	path, err := guestPath(params.Type, params.Node, params.VMID)
+	if err != nil {
+		return nil, err
+	}
+
+	var upid string
+	err = c.Do(ctx, "POST", path+"/template", nil, &upid)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not convert to template")
+	}
+	if upid == "" {
+		return nil, nil
+	}
+	return ParseUPID(upid)
+}
@@ -1,5 +1,11 @@
 package proxmox
 
-const proxmoxDomain = ".theninja.life"
-const containerStorage = "container-storage-001"
-const vmStorage = "vm-storage-001"
+// Defaults match a stock Proxmox VE install. Use the Option functions to change them
+const (
+	defaultContainerStorage = "local-lvm"
+	defaultVMStorage        = "local-lvm"
+	defaultTemplateStorage  = "local"
+	defaultISOStorage       = "local"
+	defaultSwap             = 512
+	defaultBridge           = "vmbr0"
+)
@@ -0,0 +1,428 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContainerConfig is the response from the Proxmox API for a container's configuration.
+// Keys the model does not know about are kept in Extra so that writing the config back is lossless
+type ContainerConfig struct {
+	Hostname    string
+	Description string
+	Tags        string
+	Digest      string
+	Ostype      string
+	Arch        string
+	Memory      int
+	// Swap is nil when it is not set, which Proxmox treats as 512 MB, so that 0 can turn it off
+	Swap         *int
+	Cores        int
+	Cpulimit     string
+	Nameserver   string
+	Searchdomain string
+	// Unprivileged and Onboot are nil when they are not set, which Proxmox treats as off
+	Unprivileged *bool
+	Onboot       *bool
+
+	Rootfs   *ContainerMountPoint
+	Features *ContainerFeatures
+	Startup  *Startup
+
+	// MountPoints are keyed by N of mpN, NICs by N of netN
+	MountPoints map[int]*ContainerMountPoint
+	NICs        map[int]*ContainerNIC
+
+	// LXC holds raw lxc.* keys as key and value pairs, in order
+	LXC [][2]string
+
+	Extra map[string]string
+}
+
+var containerIndexKey = regexp.MustCompile(`^(net|mp)(\d+)$`)
+
+// containerReadOnlyKeys are keys Proxmox returns in a container's config but rejects in an update
+var containerReadOnlyKeys = map[string]bool{
+	"parent":   true,
+	"snaptime": true,
+}
+
+// ParseContainerConfig builds a ContainerConfig from the raw config keys and values
+func ParseContainerConfig(values map[string]string) (*ContainerConfig, error) {
+	result := &ContainerConfig{
+		MountPoints: map[int]*ContainerMountPoint{},
+		NICs:        map[int]*ContainerNIC{},
+		Extra:       map[string]string{},
+	}
+
+	for key, value := range values {
+		err := result.set(key, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not parse container config key %s", key)
+		}
+	}
+	return result, nil
+}
+
+// set parses a single config key into the model
+func (cfg *ContainerConfig) set(key, value string) error {
+	var err error
+	switch key {
+	case "hostname":
+		cfg.Hostname = value
+	case "description":
+		cfg.Description = value
+	case "tags":
+		cfg.Tags = value
+	case "digest":
+		cfg.Digest = value
+	case "ostype":
+		cfg.Ostype = value
+	case "arch":
+		cfg.Arch = value
+	case "memory":
+		cfg.Memory, err = strconv.Atoi(value)
+	case "swap":
+		var swap int
+		swap, err = strconv.Atoi(value)
+		cfg.Swap = &swap
+	case "cores":
+		cfg.Cores, err = strconv.Atoi(value)
+	case "cpulimit":
+		cfg.Cpulimit = value
+	case "nameserver":
+		cfg.Nameserver = value
+	case "searchdomain":
+		cfg.Searchdomain = value
+	case "unprivileged":
+		unprivileged := parseBool(value)
+		cfg.Unprivileged = &unprivileged
+	case "onboot":
+		onboot := parseBool(value)
+		cfg.Onboot = &onboot
+	case "rootfs":
+		cfg.Rootfs, err = ParseContainerMountPoint(value)
+	case "features":
+		cfg.Features, err = ParseContainerFeatures(value)
+	case "startup":
+		cfg.Startup, err = ParseStartup(value)
+	default:
+		match := containerIndexKey.FindStringSubmatch(key)
+		if match == nil {
+			cfg.Extra[key] = value
+			return nil
+		}
+
+		index, _ := strconv.Atoi(match[2])
+		switch match[1] {
+		case "net":
+			cfg.NICs[index], err = ParseContainerNIC(value)
+		case "mp":
+			cfg.MountPoints[index], err = ParseContainerMountPoint(value)
+		}
+	}
+	return err
+}
+
+// Map returns the config as raw keys and values, the inverse of ParseContainerConfig.
+// The lxc.* keys are not included as they can not be set through the API
+func (cfg *ContainerConfig) Map() map[string]string {
+	result := map[string]string{}
+	for key, value := range cfg.Extra {
+		result[key] = value
+	}
+
+	ps := propertyString(result)
+	ps.setString("hostname", cfg.Hostname)
+	ps.setString("description", cfg.Description)
+	ps.setString("tags", cfg.Tags)
+	ps.setString("digest", cfg.Digest)
+	ps.setString("ostype", cfg.Ostype)
+	ps.setString("arch", cfg.Arch)
+	ps.setInt("memory", cfg.Memory)
+	if cfg.Swap != nil {
+		result["swap"] = strconv.Itoa(*cfg.Swap)
+	}
+	ps.setInt("cores", cfg.Cores)
+	ps.setString("cpulimit", cfg.Cpulimit)
+	ps.setString("nameserver", cfg.Nameserver)
+	ps.setString("searchdomain", cfg.Searchdomain)
+	ps.setOptionalBool("unprivileged", cfg.Unprivileged)
+	ps.setOptionalBool("onboot", cfg.Onboot)
+
+	if cfg.Rootfs != nil {
+		result["rootfs"] = cfg.Rootfs.String()
+	}
+	if cfg.Features != nil {
+		result["features"] = cfg.Features.String()
+	}
+	if cfg.Startup != nil {
+		result["startup"] = cfg.Startup.String()
+	}
+
+	for index, mp := range cfg.MountPoints {
+		result[fmt.Sprintf("mp%d", index)] = mp.String()
+	}
+	for index, nic := range cfg.NICs {
+		result[fmt.Sprintf("net%d", index)] = nic.String()
+	}
+	return result
+}
+
+// Values returns the config as parameters for a config update. Read-only keys like parent
+// are left out
+func (cfg *ContainerConfig) Values() url.Values {
+	return updateValues(cfg.Map(), containerReadOnlyKeys, nil)
+}
+
+// UnmarshalJSON decodes the config from the Proxmox API, which mixes numbers and strings
+// and returns the raw lxc.* keys as a list of pairs
+func (cfg *ContainerConfig) UnmarshalJSON(data []byte) error {
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return errors.Wrap(err, "Could not decode config")
+	}
+
+	var lxc [][2]string
+	if lxcRaw, ok := raw["lxc"]; ok {
+		err = json.Unmarshal(lxcRaw, &lxc)
+		if err != nil {
+			return errors.Wrap(err, "Could not decode lxc keys")
+		}
+		delete(raw, "lxc")
+	}
+
+	rest, err := json.Marshal(raw)
+	if err != nil {
+		return errors.Wrap(err, "Could not decode config")
+	}
+	values, err := decodeConfigMap(rest)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := ParseContainerConfig(values)
+	if err != nil {
+		return err
+	}
+	parsed.LXC = lxc
+	*cfg = *parsed
+	return nil
+}
+
+// MarshalJSON encodes the config as the raw keys and values, in the same shape Proxmox sends it
+func (cfg *ContainerConfig) MarshalJSON() ([]byte, error) {
+	result := map[string]interface{}{}
+	for key, value := range cfg.Map() {
+		result[key] = value
+	}
+	if len(cfg.LXC) > 0 {
+		result["lxc"] = cfg.LXC
+	}
+	return json.Marshal(result)
+}
+
+// ContainerMountPoint is the rootfs or an mpN of a container,
+// e.g. local-lvm:vm-100-disk-1,mp=/data,backup=1,size=10G
+type ContainerMountPoint struct {
+	Volume string
+	// Path is where the volume is mounted in the container. Always / for the rootfs
+	Path         string
+	Size         string
+	ACL          *bool
+	Quota        bool
+	ReadOnly     bool
+	Backup       *bool
+	Replicate    *bool
+	Shared       bool
+	MountOptions []string
+	Options      map[string]string
+}
+
+// ParseContainerMountPoint will convert a proxmox rootfs or mount point property string into a struct
+func ParseContainerMountPoint(s string) (*ContainerMountPoint, error) {
+	ps, err := parsePropertyString(s, "volume")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ContainerMountPoint{
+		Volume:    ps.take("volume"),
+		Path:      ps.take("mp"),
+		Size:      ps.take("size"),
+		ACL:       ps.takeOptionalBool("acl"),
+		Quota:     ps.takeBool("quota"),
+		ReadOnly:  ps.takeBool("ro"),
+		Backup:    ps.takeOptionalBool("backup"),
+		Replicate: ps.takeOptionalBool("replicate"),
+		Shared:    ps.takeBool("shared"),
+	}
+	if mountOptions := ps.take("mountoptions"); mountOptions != "" {
+		result.MountOptions = strings.Split(mountOptions, ";")
+	}
+	result.Options = ps
+	return result, nil
+}
+
+// String returns the mount point in Proxmox's property string format
+func (mp *ContainerMountPoint) String() string {
+	ps := copyProperties(mp.Options)
+	ps.setString("size", mp.Size)
+	ps.setOptionalBool("acl", mp.ACL)
+	ps.setBool("quota", mp.Quota)
+	ps.setBool("ro", mp.ReadOnly)
+	ps.setOptionalBool("backup", mp.Backup)
+	ps.setOptionalBool("replicate", mp.Replicate)
+	ps.setBool("shared", mp.Shared)
+	ps.setString("mountoptions", strings.Join(mp.MountOptions, ";"))
+
+	// Proxmox writes the required mp key before the optional ones
+	parts := []string{}
+	if mp.Volume != "" {
+		parts = append(parts, mp.Volume)
+	}
+	if mp.Path != "" {
+		parts = append(parts, "mp="+mp.Path)
+	}
+	if rest := ps.format(""); rest != "" {
+		parts = append(parts, rest)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ContainerNIC is a network device of a container,
+// e.g. name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:00:01,ip=dhcp,tag=10,type=veth
+type ContainerNIC struct {
+	Name string
+	// Bridge defaults to the client's default bridge when creating a container, and so does
+	// Tag when the bridge is defaulted and Tag is 0
+	Bridge string
+	MAC    string
+	// IP is an IPv4 CIDR, dhcp or manual. Gateway is only used with a CIDR
+	IP      string
+	Gateway string
+	// IP6 is an IPv6 CIDR, auto for SLAAC, dhcp or manual. Gateway6 is only used with a CIDR
+	IP6      string
+	Gateway6 string
+	Tag      int
+	Firewall bool
+	LinkDown bool
+	MTU      int
+	// Rate is the rate limit in MB/s
+	Rate    string
+	Trunks  string
+	Type    string
+	Options map[string]string
+}
+
+// ParseContainerNIC will convert a proxmox container network device property string into a struct
+func ParseContainerNIC(s string) (*ContainerNIC, error) {
+	ps, err := parsePropertyString(s, "")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ContainerNIC{
+		Name:     ps.take("name"),
+		Bridge:   ps.take("bridge"),
+		MAC:      ps.take("hwaddr"),
+		IP:       ps.take("ip"),
+		Gateway:  ps.take("gw"),
+		IP6:      ps.take("ip6"),
+		Gateway6: ps.take("gw6"),
+		Firewall: ps.takeBool("firewall"),
+		LinkDown: ps.takeBool("link_down"),
+		Rate:     ps.take("rate"),
+		Trunks:   ps.take("trunks"),
+		Type:     ps.take("type"),
+	}
+	result.Tag, err = ps.takeInt("tag")
+	if err != nil {
+		return nil, err
+	}
+	result.MTU, err = ps.takeInt("mtu")
+	if err != nil {
+		return nil, err
+	}
+	result.Options = ps
+	return result, nil
+}
+
+// String returns the NIC in Proxmox's property string format, which puts the name first
+func (n *ContainerNIC) String() string {
+	ps := copyProperties(n.Options)
+	ps.setString("bridge", n.Bridge)
+	ps.setString("hwaddr", n.MAC)
+	ps.setString("ip", n.IP)
+	ps.setString("gw", n.Gateway)
+	ps.setString("ip6", n.IP6)
+	ps.setString("gw6", n.Gateway6)
+	ps.setInt("tag", n.Tag)
+	ps.setBool("firewall", n.Firewall)
+	ps.setBool("link_down", n.LinkDown)
+	ps.setInt("mtu", n.MTU)
+	ps.setString("rate", n.Rate)
+	ps.setString("trunks", n.Trunks)
+	ps.setString("type", n.Type)
+
+	rest := ps.format("")
+	if n.Name == "" {
+		return rest
+	}
+	if rest == "" {
+		return "name=" + n.Name
+	}
+	return "name=" + n.Name + "," + rest
+}
+
+// ContainerFeatures are the advanced features of a container, e.g. nesting=1,keyctl=1,mount=nfs;cifs
+type ContainerFeatures struct {
+	Nesting    bool
+	Keyctl     bool
+	Fuse       bool
+	Mknod      bool
+	ForceRWSys bool
+	// Mount lists the filesystem types the container may mount
+	Mount   []string
+	Options map[string]string
+}
+
+// ParseContainerFeatures will convert a proxmox features property string into a struct
+func ParseContainerFeatures(s string) (*ContainerFeatures, error) {
+	ps, err := parsePropertyString(s, "")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ContainerFeatures{
+		Nesting:    ps.takeBool("nesting"),
+		Keyctl:     ps.takeBool("keyctl"),
+		Fuse:       ps.takeBool("fuse"),
+		Mknod:      ps.takeBool("mknod"),
+		ForceRWSys: ps.takeBool("force_rw_sys"),
+	}
+	if mount := ps.take("mount"); mount != "" {
+		result.Mount = strings.Split(mount, ";")
+	}
+	result.Options = ps
+	return result, nil
+}
+
+// String returns the features in Proxmox's property string format
+func (f *ContainerFeatures) String() string {
+	ps := copyProperties(f.Options)
+	ps.setBool("nesting", f.Nesting)
+	ps.setBool("keyctl", f.Keyctl)
+	ps.setBool("fuse", f.Fuse)
+	ps.setBool("mknod", f.Mknod)
+	ps.setBool("force_rw_sys", f.ForceRWSys)
+	ps.setString("mount", strings.Join(f.Mount, ";"))
+	return ps.format("")
+}
@@ -0,0 +1,108 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestContainerConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name: "unprivileged debian",
+			config: `{
+				"arch": "amd64",
+				"cores": 2,
+				"digest": "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b",
+				"features": "keyctl=1,nesting=1",
+				"hostname": "web-1",
+				"memory": 1024,
+				"net0": "name=eth0,bridge=vmbr0,firewall=1,hwaddr=BC:24:11:5A:6B:7C,ip=dhcp,type=veth",
+				"onboot": 1,
+				"ostype": "debian",
+				"rootfs": "local-lvm:vm-200-disk-0,size=8G",
+				"startup": "order=1",
+				"swap": 512,
+				"tags": "prod;web",
+				"unprivileged": 1
+			}`,
+		},
+		{
+			name: "explicit off flags",
+			config: `{
+				"hostname": "db-1",
+				"memory": 4096,
+				"mp0": "local-lvm:vm-201-disk-1,mp=/var/lib/postgresql,backup=0,size=32G",
+				"net0": "name=eth0,bridge=vmbr0,firewall=0,gw=10.0.0.1,hwaddr=BC:24:11:00:00:01,ip=10.0.0.5/24,tag=20,type=veth",
+				"onboot": 0,
+				"rootfs": "local-lvm:vm-201-disk-0,size=8G",
+				"swap": 0,
+				"unprivileged": 0
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertConfigRoundTrip(t, tt.config, &ContainerConfig{})
+		})
+	}
+}
+
+func TestContainerConfigKeepsLXCKeys(t *testing.T) {
+	config := `{
+		"hostname": "vpn",
+		"lxc": [["lxc.cgroup2.devices.allow", "c 10:200 rwm"], ["lxc.mount.entry", "/dev/net dev/net none bind,create=dir"]],
+		"memory": 512
+	}`
+
+	cfg := &ContainerConfig{}
+	err := json.Unmarshal([]byte(config), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &ContainerConfig{}
+	err = json.Unmarshal(data, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][2]string{
+		{"lxc.cgroup2.devices.allow", "c 10:200 rwm"},
+		{"lxc.mount.entry", "/dev/net dev/net none bind,create=dir"},
+	}
+	if !reflect.DeepEqual(decoded.LXC, want) {
+		t.Errorf("got %v, want %v", decoded.LXC, want)
+	}
+}
+
+func TestContainerConfigValuesSkipsReadOnlyKeys(t *testing.T) {
+	cfg, err := ParseContainerConfig(map[string]string{
+		"hostname": "web-1",
+		"memory":   "1024",
+		"parent":   "before-upgrade",
+		"snaptime": "1712345678",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := cfg.Values()
+	for _, key := range []string{"parent", "snaptime"} {
+		if _, ok := values[key]; ok {
+			t.Errorf("got %s=%q, want it left out", key, values.Get(key))
+		}
+	}
+	for _, key := range []string{"hostname", "memory"} {
+		if _, ok := values[key]; !ok {
+			t.Errorf("got no %s, want it sent", key)
+		}
+	}
+}
@@ -2,14 +2,12 @@ package proxmox
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"net/http"
-	"net/url"
 	"strconv"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 // ContainerCreateRequest is a request to the Proxmox API to create a container
@@ -22,10 +20,87 @@ type ContainerCreateRequest struct {
 	Memory          int
 	StorageCapacity int
 	StorageID       string
-	SSHPublicKey    string
-	Password        string
-	HostName        string
-	IPAddress       string
+	// SSHPublicKey is added to root's authorized_keys. It may hold several keys, one per line
+	SSHPublicKey string
+	Password     string
+	HostName     string
+	// Description is shown in the container's notes, which every user with access to it can read
+	Description string
+	// Metadata is TOML encoded into the description after Description, so it can be read
+	// back with ContainerConfig. Never put secrets in it
+	Metadata interface{}
+	// Swap is in MB. Defaults to the client's default swap
+	Swap *int
+	// IPAddress and MAC configure a single eth0 on the default bridge when NICs is empty.
+	// IPAddress is an IPv4 CIDR, or empty for DHCP
+	IPAddress string
+	// NICs become net0, net1, ... Name defaults to eth0, eth1, ... and Type to veth
+	NICs []*ContainerNIC
+	// MountPoints are keyed by N of mpN. A Volume of storage:size, e.g. local-lvm:8,
+	// allocates a new volume of that many GiB
+	MountPoints map[int]*ContainerMountPoint
+
+	Unprivileged bool
+	Features     *ContainerFeatures
+	// OSType is normally detected from the template
+	OSType       string
+	Nameserver   string
+	Searchdomain string
+	// Timezone is a zone name like Europe/Berlin, or host to use the node's timezone
+	Timezone string
+	Tags     []string
+	Pool     string
+	Onboot   bool
+	Startup  *Startup
+	// Start starts the container once it has been created
+	Start bool
+}
+
+// containerNICs returns the NICs to create the container with, filling in defaults
+func (c *Client) containerNICs(params *ContainerCreateRequest) []*ContainerNIC {
+	nics := params.NICs
+	if len(nics) == 0 {
+		ip := params.IPAddress
+		if ip == "" {
+			ip = "dhcp"
+		}
+		nics = []*ContainerNIC{{MAC: params.MAC, IP: ip}}
+	}
+
+	result := make([]*ContainerNIC, 0, len(nics))
+	for i, nic := range nics {
+		withDefaults := *nic
+		if withDefaults.Name == "" {
+			withDefaults.Name = fmt.Sprintf("eth%d", i)
+		}
+		if withDefaults.Bridge == "" {
+			withDefaults.Bridge = c.defaultBridge
+			if withDefaults.Tag == 0 {
+				withDefaults.Tag = c.defaultTag
+			}
+		}
+		if withDefaults.Type == "" {
+			withDefaults.Type = "veth"
+		}
+		result = append(result, &withDefaults)
+	}
+	return result
+}
+
+// containerDescription returns the description followed by the TOML encoded metadata
+func containerDescription(params *ContainerCreateRequest) (string, error) {
+	if params.Metadata == nil {
+		return params.Description, nil
+	}
+
+	var buf bytes.Buffer
+	if params.Description != "" {
+		buf.WriteString(params.Description + "\n\n")
+	}
+	if err := toml.NewEncoder(&buf).Encode(params.Metadata); err != nil {
+		return "", errors.Wrap(err, "Could not encode metadata")
+	}
+	return buf.String(), nil
 }
 
 // ParsedTemplate is the result of magical regex on a filepath to get template info
@@ -49,26 +124,28 @@ type ContainerConfigRequest struct {
 	VMID int
 }
 
-// ContainerConfig is the response from the Proxmox API for a VM's configuration
-type ContainerConfig struct {
-	Memory      int    `json:"memory"`
-	Cpulimit    string `json:"cpulimit"`
-	Digest      string `json:"digest"`
-	Cores       int    `json:"cores"`
-	Ostype      string `json:"ostype"`
-	Rootfs      string `json:"rootfs"`
-	Hostname    string `json:"hostname"`
-	Arch        string `json:"arch"`
-	Description string `json:"description"`
-	Swap        int    `json:"swap"`
-	Net0        string `json:"net0"`
-}
-
 // ContainerConfigResponse is the response from the Proxmox API for a VM's configuration
 type ContainerConfigResponse struct {
 	Data *ContainerConfig `json:"data"`
 }
 
+// ContainerUpdateRequest is a request to the Proxmox API to change a container's config.
+// Zero values are left unchanged; list keys in Delete to remove them, e.g. net1 or mp0
+type ContainerUpdateRequest struct {
+	Node        string
+	VMID        int
+	Cores       int
+	Memory      int
+	Swap        *int
+	HostName    string
+	Description string
+	NICs        map[int]*ContainerNIC
+	MountPoints map[int]*ContainerMountPoint
+	Delete      []string
+	// Digest is the ContainerConfig.Digest the update is based on
+	Digest string
+}
+
 // ContainerVMStatusRequest is the request for the Proxmox API to modify a container or VM's status
 type ContainerVMStatusRequest struct {
 	Node      string
@@ -78,41 +155,32 @@ type ContainerVMStatusRequest struct {
 
 // ContainerConfig returns the container config
 func (c *Client) ContainerConfig(params *ContainerConfigRequest) (*ContainerConfig, error) {
-	log.WithFields(logrus.Fields{
+	return c.ContainerConfigContext(context.Background(), params)
+}
+
+// ContainerConfigContext is ContainerConfig with a context for cancellation and deadlines
+func (c *Client) ContainerConfigContext(ctx context.Context, params *ContainerConfigRequest) (*ContainerConfig, error) {
+	c.debug("Getting container config", Fields{
 		"node": params.Node,
 		"vmid": params.VMID,
-	}).Debugln("Getting container config")
-
-	authed, err := c.VerifyTicket()
-	if err != nil {
-		return nil, err
-	}
-
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return nil, err
-		}
-	}
+	})
 
-	u, err := url.Parse(fmt.Sprintf("%s/api2/json/nodes/%s/lxc/%d/config", c.host, params.Node, params.VMID))
+	result := &ContainerConfig{}
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/lxc/%d/config", params.Node, params.VMID), nil, result)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "Could not get container config")
 	}
-
-	resp, err := c.client.Get(u.String())
-	if resp.StatusCode != http.StatusOK {
-		err := fmt.Sprintf("Could not get container config: %s", resp.Status)
-		return nil, errors.New(err)
-	}
-	result := &ContainerConfigResponse{}
-	MustDecodeJSON(resp.Body, result)
-	return result.Data, nil
+	return result, nil
 }
 
 // ContainerCreate runs the Create action for the Proxmox containers
-func (c *Client) ContainerCreate(params *ContainerCreateRequest) error {
-	log.WithFields(logrus.Fields{
+func (c *Client) ContainerCreate(params *ContainerCreateRequest) (*UPID, error) {
+	return c.ContainerCreateContext(context.Background(), params)
+}
+
+// ContainerCreateContext is ContainerCreate with a context for cancellation and deadlines
+func (c *Client) ContainerCreateContext(ctx context.Context, params *ContainerCreateRequest) (*UPID, error) {
+	c.debug("Creating container", Fields{
 		"MAC":             params.MAC,
 		"Template":        params.Template,
 		"Node":            params.Node,
@@ -125,129 +193,160 @@ func (c *Client) ContainerCreate(params *ContainerCreateRequest) error {
 		"Password":        params.Password,
 		"HostName":        params.HostName,
 		"IPAddress":       params.IPAddress,
-	}).Debugln("Creating container")
+		"Unprivileged":    params.Unprivileged,
+		"Pool":            params.Pool,
+		"Start":           params.Start,
+	})
 
-	authed, err := c.VerifyTicket()
+	description, err := containerDescription(params)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return err
-		}
+	storage := params.StorageID
+	if storage == "" {
+		storage = c.containerStorage
 	}
-
-	u, err := url.Parse(fmt.Sprintf("%s/api2/json/nodes/%s/lxc", c.host, params.Node))
-	if err != nil {
-		return err
+	swap := c.defaultSwap
+	if params.Swap != nil {
+		swap = *params.Swap
 	}
 
-	req, err := http.NewRequest("POST", u.String(), nil)
-	if err != nil {
-		return errors.Wrap(err, "Could not create request")
+	p := requestParams{}
+	p.setString("ostemplate", c.templateStorage+":vztmpl/"+params.Template.String())
+	p.setInt("vmid", params.VMID)
+	p.setString("storage", storage)
+	p.setOptionalInt("swap", &swap)
+	p.setInt("cores", params.CPUCores)
+	p.setString("rootfs", fmt.Sprintf("%d", params.StorageCapacity))
+	p.setInt("cpulimit", params.CPUCores)
+	p.setInt("memory", params.Memory)
+	p.setString("hostname", params.HostName)
+	p.setString("password", params.Password)
+	p.setString("description", description)
+	for i, nic := range c.containerNICs(params) {
+		p.setString(fmt.Sprintf("net%d", i), nic.String())
 	}
-
-	var buf bytes.Buffer
-	if err := toml.NewEncoder(&buf).Encode(params); err != nil {
-		log.Fatal(err)
-	}
-
-	q := req.URL.Query()
-	q.Add("ostemplate", "templates:vztmpl/"+params.Template.String())
-	q.Add("vmid", strconv.Itoa(params.VMID))
-	q.Add("storage", params.StorageID)
-	q.Add("swap", "512")
-	q.Add("cores", strconv.Itoa(params.CPUCores))
-	q.Add("rootfs", fmt.Sprintf("%d", params.StorageCapacity))
-	q.Add("cpulimit", strconv.Itoa(params.CPUCores))
-	q.Add("memory", strconv.Itoa(params.Memory))
-	q.Add("hostname", params.HostName)
-	q.Add("password", params.Password)
-	q.Add("description", buf.String())
-	q.Add("net0", fmt.Sprintf("name=eth0,bridge=vmbr3,hwaddr=%s,ip=dhcp,tag=10,type=veth", params.MAC))
-
-	req.URL.RawQuery = q.Encode()
-	req.Header.Set("CSRFPreventionToken", c.CSRFToken)
-
-	proxmoxResp, err := c.client.Do(req)
-	if err != nil {
-		return errors.Wrap(err, "Could not execute request")
+	for index, mp := range params.MountPoints {
+		p.setString(fmt.Sprintf("mp%d", index), mp.String())
 	}
-	if proxmoxResp.StatusCode != http.StatusOK {
-		dump(proxmoxResp)
-		err := fmt.Sprintf("Could not create container: %s", proxmoxResp.Status)
-		return errors.New(err)
+	p.setString("ssh-public-keys", params.SSHPublicKey)
+	p.setBool("unprivileged", params.Unprivileged)
+	if params.Features != nil {
+		p.setString("features", params.Features.String())
 	}
-	return nil
-}
-
-// ContainerAdd runs the Add action for the Proxmox containers
-func (c *Client) ContainerAdd(container *Resource) error { panic("Not implemented") }
-
-// ContainerUpdate runs the Update action for the Proxmox containers
-func (c *Client) ContainerUpdate(container *Resource) error { panic("Not implemented") }
-
-// ContainerDelete runs the Delete action for the Proxmox containers
-func (c *Client) ContainerDelete(node string, vmid int) error {
-	log.WithFields(logrus.Fields{
-		"node": node,
-		"vmid": strconv.Itoa(vmid),
-	}).Debugln("Deleting container")
-	u, err := url.Parse(fmt.Sprintf("%s/api2/json/nodes/%s/lxc/%s", c.host, node, strconv.Itoa(vmid)))
-	if err != nil {
-		return err
+	p.setString("ostype", params.OSType)
+	p.setString("nameserver", params.Nameserver)
+	p.setString("searchdomain", params.Searchdomain)
+	p.setString("timezone", params.Timezone)
+	p.setList("tags", params.Tags, ";")
+	p.setString("pool", params.Pool)
+	p.setBool("onboot", params.Onboot)
+	if params.Startup != nil {
+		p.setString("startup", params.Startup.String())
 	}
+	p.setBool("start", params.Start)
 
-	authed, err := c.VerifyTicket()
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("/nodes/%s/lxc", params.Node), p.values())
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "Could not create container")
 	}
+	return upid, nil
+}
 
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return err
-		}
+// ContainerUpdate changes the config of an existing container. NICs and mount points are
+// added or replaced by index. If Digest is set and the config was changed since it was read,
+// the update fails with an error that satisfies IsConflict
+func (c *Client) ContainerUpdate(params *ContainerUpdateRequest) error {
+	return c.ContainerUpdateContext(context.Background(), params)
+}
+
+// ContainerUpdateContext is ContainerUpdate with a context for cancellation and deadlines
+func (c *Client) ContainerUpdateContext(ctx context.Context, params *ContainerUpdateRequest) error {
+	c.debug("Updating container config", Fields{
+		"node":   params.Node,
+		"vmid":   params.VMID,
+		"delete": params.Delete,
+		"digest": params.Digest,
+	})
+
+	p := requestParams{}
+	p.setInt("cores", params.Cores)
+	p.setInt("memory", params.Memory)
+	p.setOptionalInt("swap", params.Swap)
+	p.setString("hostname", params.HostName)
+	p.setString("description", params.Description)
+	for index, nic := range params.NICs {
+		p.setString(fmt.Sprintf("net%d", index), nic.String())
+	}
+	for index, mp := range params.MountPoints {
+		p.setString(fmt.Sprintf("mp%d", index), mp.String())
 	}
+	p.setList("delete", params.Delete, ",")
+	p.setString("digest", params.Digest)
 
-	req, err := http.NewRequest("DELETE", u.String(), nil)
+	err := c.Do(ctx, "PUT", fmt.Sprintf("/nodes/%s/lxc/%d/config", params.Node, params.VMID), p.values(), nil)
 	if err != nil {
-		return errors.Wrap(err, "Could not create request")
+		return errors.Wrap(err, "Could not update container")
 	}
+	return nil
+}
 
-	req.Header.Set("CSRFPreventionToken", c.CSRFToken)
+// ContainerDelete runs the Delete action for the Proxmox containers
+func (c *Client) ContainerDelete(node string, vmid int) (*UPID, error) {
+	return c.ContainerDeleteContext(context.Background(), node, vmid)
+}
 
-	proxmoxResp, err := c.client.Do(req)
-	if err != nil {
-		return errors.Wrap(err, "Could not execute request")
-	}
+// ContainerDeleteContext is ContainerDelete with a context for cancellation and deadlines
+func (c *Client) ContainerDeleteContext(ctx context.Context, node string, vmid int) (*UPID, error) {
+	c.debug("Deleting container", Fields{
+		"node": node,
+		"vmid": strconv.Itoa(vmid),
+	})
 
-	if proxmoxResp.StatusCode != http.StatusOK {
-		dump(proxmoxResp)
-		err := fmt.Sprintf("Could not create container: %s", proxmoxResp.Status)
-		return errors.New(err)
+	upid, err := c.doTask(ctx, "DELETE", fmt.Sprintf("/nodes/%s/lxc/%d", node, vmid), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not delete container")
 	}
-	return nil
+	return upid, nil
 }
 
 // ContainerStop will stop the container
-func (c *Client) ContainerStop(params *ContainerVMStatusRequest) error {
-	return c.vmStatusPOSTHelper("stop", params.Node, params.VMID, "lxc")
+func (c *Client) ContainerStop(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.ContainerStopContext(context.Background(), params)
+}
+
+// ContainerStopContext is ContainerStop with a context for cancellation and deadlines
+func (c *Client) ContainerStopContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "stop", params.Node, params.VMID, "lxc")
 }
 
 // ContainerStart will start the container
-func (c *Client) ContainerStart(params *ContainerVMStatusRequest) error {
-	return c.vmStatusPOSTHelper("start", params.Node, params.VMID, "lxc")
+func (c *Client) ContainerStart(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.ContainerStartContext(context.Background(), params)
+}
+
+// ContainerStartContext is ContainerStart with a context for cancellation and deadlines
+func (c *Client) ContainerStartContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "start", params.Node, params.VMID, "lxc")
 }
 
 // ContainerShutdown will shutdown the container
-func (c *Client) ContainerShutdown(params *ContainerVMStatusRequest) error {
-	return c.vmStatusPOSTHelper("shutdown", params.Node, params.VMID, "lxc")
+func (c *Client) ContainerShutdown(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.ContainerShutdownContext(context.Background(), params)
+}
+
+// ContainerShutdownContext is ContainerShutdown with a context for cancellation and deadlines
+func (c *Client) ContainerShutdownContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "shutdown", params.Node, params.VMID, "lxc")
 }
 
 // ContainerResume will start the container
-func (c *Client) ContainerResume(params *ContainerVMStatusRequest) error {
-	return c.vmStatusPOSTHelper("resume", params.Node, params.VMID, "lxc")
+func (c *Client) ContainerResume(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.ContainerResumeContext(context.Background(), params)
+}
+
+// ContainerResumeContext is ContainerResume with a context for cancellation and deadlines
+func (c *Client) ContainerResumeContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "resume", params.Node, params.VMID, "lxc")
 }
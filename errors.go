@@ -0,0 +1,139 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// APIError is returned when the Proxmox API responds with a non 2xx status.
+// Use errors.As, or the IsNotFound, IsUnauthorized and IsConflict helpers, to inspect it
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	// Message is the reason Proxmox gave, which it puts in the status line rather than the body
+	Message string
+	// Errors maps each rejected parameter to its validation message
+	Errors map[string]string
+}
+
+// apiErrorResponse is the body Proxmox sends alongside a failed request
+type apiErrorResponse struct {
+	Message string            `json:"message"`
+	Errors  map[string]string `json:"errors"`
+}
+
+// newAPIError builds an APIError from a failed response, consuming its body
+func newAPIError(resp *http.Response) *APIError {
+	result := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+	}
+	if resp.Request != nil {
+		result.Method = resp.Request.Method
+		result.Path = resp.Request.URL.Path
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return result
+	}
+
+	parsed := &apiErrorResponse{}
+	if json.Unmarshal(body, parsed) != nil {
+		return result
+	}
+	if parsed.Message != "" {
+		result.Message = strings.TrimSpace(parsed.Message)
+	}
+	result.Errors = parsed.Errors
+	return result
+}
+
+// Error returns the status, the reason and any per-parameter errors
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+	if len(e.Errors) == 0 {
+		return msg
+	}
+
+	params := make([]string, 0, len(e.Errors))
+	for param := range e.Errors {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	details := make([]string, 0, len(params))
+	for _, param := range params {
+		details = append(details, fmt.Sprintf("%s: %s", param, strings.TrimSpace(e.Errors[param])))
+	}
+	return fmt.Sprintf("%s (%s)", msg, strings.Join(details, "; "))
+}
+
+// IsNotFound reports whether err is an APIError for a missing resource.
+// Proxmox answers most lookups of missing guests with a 500 "does not exist", so that counts too
+func IsNotFound(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound || strings.Contains(apiErr.Message, "does not exist")
+}
+
+// IsUnauthorized reports whether err is an APIError for a rejected ticket or token
+func IsUnauthorized(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether err is an APIError for a permission the user does not have
+func IsForbidden(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusForbidden
+}
+
+// IsConflict reports whether err is an APIError for a resource that already exists
+// or a config that was changed by someone else in the meantime
+func IsConflict(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusConflict || isConflictMessage(apiErr.Message) {
+		return true
+	}
+	// Some endpoints, like nextid, report a taken VMID as an invalid parameter
+	for _, message := range apiErr.Errors {
+		if isConflictMessage(message) {
+			return true
+		}
+	}
+	return false
+}
+
+// isConflictMessage returns true for the messages Proxmox uses for conflicts
+func isConflictMessage(message string) bool {
+	return strings.Contains(message, "already exists") ||
+		strings.Contains(message, "detected modified configuration")
+}
+
+// asAPIError finds an APIError in the chain of wrapped errors
+func asAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
@@ -1,6 +1,7 @@
 package proxmox
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
@@ -9,7 +10,6 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"regexp"
 	"strconv"
 
@@ -18,44 +18,23 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (c *Client) vmStatusPOSTHelper(action string, node string, containerID int, vmType string) error {
-	authed, err := c.VerifyTicket()
+func (c *Client) vmStatusPOSTHelper(ctx context.Context, action string, node string, containerID int, vmType string) (*UPID, error) {
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("/nodes/%s/%s/%d/status/%s", node, vmType, containerID, action), nil)
 	if err != nil {
-		return err
-	}
-
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return err
+		guest := "container"
+		if vmType == "qemu" {
+			guest = "VM"
 		}
+		return nil, errors.Wrapf(err, "Could not %s %s", action, guest)
 	}
-
-	u, err := url.Parse(fmt.Sprintf("%s/api2/json/nodes/%s/%s/%d/status/%s", c.host, node, vmType, containerID, action))
-	if err != nil {
-		return errors.Wrap(err, "Could not parse URL")
-	}
-
-	req, err := http.NewRequest("POST", u.String(), nil)
-	if err != nil {
-		return errors.Wrap(err, "Could not create request")
-	}
-	req.Header.Set("CSRFPreventionToken", c.CSRFToken)
-
-	proxmoxResp, err := c.client.Do(req)
-	if err != nil {
-		return errors.Wrap(err, "Could not execute request")
-	}
-	if proxmoxResp.StatusCode != http.StatusOK {
-		err := fmt.Sprintf("Could not %s container: %s", action, proxmoxResp.Status)
-		return errors.New(err)
-	}
-	return nil
+	return upid, nil
 }
 
-func dump(resp *http.Response) {
+// dump logs the whole response with any credentials redacted. The body is replaced with a
+// copy so it can still be read
+func (c *Client) dump(resp *http.Response) {
 	d, _ := httputil.DumpResponse(resp, true)
-	log.Debugln(string(d))
+	c.debug(redactDump(string(d)), nil)
 }
 
 // Error is a struct with which we can marshal into JSON for a HTTP response
@@ -64,6 +43,8 @@ type Error struct {
 }
 
 // MustReadAll will read the response body as a string
+//
+// Deprecated: Use ioutil.ReadAll, which returns the error instead of panicking
 func MustReadAll(r io.Reader) string {
 	buf, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -98,12 +79,12 @@ func GenerateMAC() (net.HardwareAddr, error) {
 }
 
 // HashPassword encrypts a plaintext string and returns the hashed version
-func HashPassword(password string) string {
+func HashPassword(password string) (string, error) {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		panic(err)
+		return "", errors.Wrap(err, "Could not hash password")
 	}
-	return string(hashed)
+	return string(hashed), nil
 }
 
 // MustGetInt will get an integer from ninjarouter URL or panic
@@ -122,12 +103,23 @@ func MustGetString(r *http.Request, name string) string {
 	return nameStr
 }
 
-// MustDecodeJSON receives a pointer to struct, and updates the struct values
+// DecodeJSON receives a pointer to struct, and updates the struct values
 // with the values from the JSON in the http request
-func MustDecodeJSON(body io.Reader, target interface{}) {
+func DecodeJSON(body io.Reader, target interface{}) error {
 	err := json.NewDecoder(body).Decode(target)
 	if err != nil {
-		panic(errors.Wrap(err, "Could not decode JSON"))
+		return errors.Wrap(err, "Could not decode JSON")
+	}
+	return nil
+}
+
+// MustDecodeJSON is DecodeJSON but panics if the JSON can not be decoded
+//
+// Deprecated: Use DecodeJSON, which returns the error instead of panicking
+func MustDecodeJSON(body io.Reader, target interface{}) {
+	err := DecodeJSON(body, target)
+	if err != nil {
+		panic(err)
 	}
 }
 
@@ -157,6 +149,10 @@ func ParseTemplate(templateStr string) (*RaijinTemplate, error) {
 
 	r := regexp.MustCompile(expr)
 	result := r.FindStringSubmatch(templateStr)
+	if result == nil {
+		return nil, errors.New("no matches found from template")
+	}
+
 	template := &RaijinTemplate{
 		OS:         result[1],
 		OSVersion:  result[2],
@@ -1,8 +1,11 @@
 package proxmox
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+
+	"github.com/pkg/errors"
 )
 
 // ISO is the response from the proxmox API for ISO content in a storage
@@ -20,30 +23,22 @@ type ISOListResponse struct {
 
 // ISOList returns a list of ISOs
 func (c *Client) ISOList(node string) ([]string, error) {
-	log.Debugln("Getting ISOs from Proxmox")
-	authed, err := c.VerifyTicket()
-	if err != nil {
-		return nil, err
-	}
+	return c.ISOListContext(context.Background(), node)
+}
 
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return nil, err
-		}
-	}
+// ISOListContext is ISOList with a context for cancellation and deadlines
+func (c *Client) ISOListContext(ctx context.Context, node string) ([]string, error) {
+	c.debug("Getting ISOs from Proxmox", nil)
 
-	u, err := url.Parse(fmt.Sprintf(c.host+"/api2/json/nodes/%s/storage/ISOs/content", node))
-	proxmoxAPIResp, err := c.client.Get(u.String())
+	params := url.Values{"content": []string{"iso"}}
+	var isos []*ISO
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/storage/%s/content", node, c.isoStorage), params, &isos)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "Could not get ISOs")
 	}
-	dump(proxmoxAPIResp)
-	proxmoxResponse := &ISOListResponse{}
-	MustDecodeJSON(proxmoxAPIResp.Body, &proxmoxResponse)
-	log.Println(proxmoxResponse)
+
 	result := []string{}
-	for _, iso := range proxmoxResponse.Data {
+	for _, iso := range isos {
 		result = append(result, iso.Volid)
 	}
 	return result, nil
@@ -0,0 +1,40 @@
+package proxmox
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Fields are the structured values logged with a message
+type Fields map[string]interface{}
+
+// Logger receives the client's debug logs. Use NewLogrusLogger or NewSlogLogger to log to an
+// existing logger, or implement it to log anywhere else
+type Logger interface {
+	Debug(msg string, fields Fields)
+}
+
+// nopLogger discards everything, and is the default until WithLogger is used
+type nopLogger struct{}
+
+// Debug does nothing
+func (nopLogger) Debug(msg string, fields Fields) {}
+
+// logrusLogger logs to a logrus logger or entry
+type logrusLogger struct {
+	log logrus.FieldLogger
+}
+
+// NewLogrusLogger returns a Logger that writes to a logrus logger or entry
+func NewLogrusLogger(log logrus.FieldLogger) Logger {
+	return &logrusLogger{log: log}
+}
+
+// Debug logs the message and fields at debug level
+func (l *logrusLogger) Debug(msg string, fields Fields) {
+	l.log.WithFields(logrus.Fields(fields)).Debugln(msg)
+}
+
+// debug logs to the client's logger with any credentials in the fields redacted
+func (c *Client) debug(msg string, fields Fields) {
+	c.logger.Debug(msg, redactFields(fields))
+}
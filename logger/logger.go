@@ -20,10 +20,11 @@ func New(prod, debug bool) *logrus.Logger {
 	return log
 }
 
-// Get returns the singleton instance of the logger
+// Get returns the singleton instance of the logger, or a logrus logger with the default
+// settings if New has not been called
 func Get() *logrus.Logger {
 	if log == nil {
-		panic("logger not initialized")
+		log = logrus.New()
 	}
 	return log
 }
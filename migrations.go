@@ -0,0 +1,174 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContainerMigrateRequest is a request to the Proxmox API to move a container to another node
+type ContainerMigrateRequest struct {
+	Node   string
+	VMID   int
+	Target string
+	// Restart shuts a running container down, moves it and starts it again on the target.
+	// Without it only stopped containers can be migrated
+	Restart bool
+	// Timeout is how many seconds a restart migration waits for the container to shut down
+	Timeout int
+	// TargetStorage moves every volume to one storage. StorageMap maps source storages to
+	// target storages and takes precedence for the storages it names
+	TargetStorage string
+	StorageMap    map[string]string
+	// BandwidthLimit is in KiB/s
+	BandwidthLimit int
+}
+
+// VMMigrateRequest is a request to the Proxmox API to move a VM to another node
+type VMMigrateRequest struct {
+	Node   string
+	VMID   int
+	Target string
+	// Online live migrates a running VM
+	Online bool
+	// WithLocalDisks copies disks on storage that is local to the node
+	WithLocalDisks bool
+	// TargetStorage moves every local disk to one storage. StorageMap maps source storages to
+	// target storages and takes precedence for the storages it names
+	TargetStorage string
+	StorageMap    map[string]string
+	// BandwidthLimit is in KiB/s
+	BandwidthLimit int
+}
+
+// VMMigratePreconditions is the response from the Proxmox API for whether a VM can be migrated
+type VMMigratePreconditions struct {
+	Running int `json:"running"`
+	// AllowedNodes and NotAllowedNodes are only set for stopped VMs
+	AllowedNodes    []string                         `json:"allowed_nodes"`
+	NotAllowedNodes map[string]*VMMigrateNodeBlocker `json:"not_allowed_nodes"`
+	// LocalDisks need WithLocalDisks to be migrated
+	LocalDisks []*VMMigrateLocalDisk `json:"local_disks"`
+	// LocalResources like passed through PCI or USB devices prevent migration
+	LocalResources []string `json:"local_resources"`
+}
+
+// VMMigrateNodeBlocker explains why a VM can not be migrated to a node
+type VMMigrateNodeBlocker struct {
+	UnavailableStorages []string `json:"unavailable_storages"`
+}
+
+// VMMigrateLocalDisk is a disk on storage that is local to the VM's node
+type VMMigrateLocalDisk struct {
+	Volid      string `json:"volid"`
+	Size       int64  `json:"size"`
+	DriveName  string `json:"drivename"`
+	CDROM      int    `json:"cdrom"`
+	IsUnused   int    `json:"is_unused"`
+	Replicated int    `json:"replicated"`
+}
+
+// storageMapping returns the targets in Proxmox's storage list format,
+// e.g. fast,local-lvm:slow to move local-lvm to slow and everything else to fast
+func storageMapping(target string, mapping map[string]string) string {
+	parts := []string{}
+	if target != "" {
+		parts = append(parts, target)
+	}
+
+	sources := make([]string, 0, len(mapping))
+	for source := range mapping {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		parts = append(parts, source+":"+mapping[source])
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// ContainerMigrate moves a container to the target node
+func (c *Client) ContainerMigrate(params *ContainerMigrateRequest) (*UPID, error) {
+	return c.ContainerMigrateContext(context.Background(), params)
+}
+
+// ContainerMigrateContext is ContainerMigrate with a context for cancellation and deadlines
+func (c *Client) ContainerMigrateContext(ctx context.Context, params *ContainerMigrateRequest) (*UPID, error) {
+	c.debug("Migrating container", Fields{
+		"node":    params.Node,
+		"vmid":    params.VMID,
+		"target":  params.Target,
+		"restart": params.Restart,
+	})
+
+	p := requestParams{}
+	p.setString("target", params.Target)
+	p.setBool("restart", params.Restart)
+	p.setInt("timeout", params.Timeout)
+	p.setString("target-storage", storageMapping(params.TargetStorage, params.StorageMap))
+	p.setInt("bwlimit", params.BandwidthLimit)
+
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("/nodes/%s/lxc/%d/migrate", params.Node, params.VMID), p.values())
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not migrate container")
+	}
+	return upid, nil
+}
+
+// VMMigrate moves a VM to the target node
+func (c *Client) VMMigrate(params *VMMigrateRequest) (*UPID, error) {
+	return c.VMMigrateContext(context.Background(), params)
+}
+
+// VMMigrateContext is VMMigrate with a context for cancellation and deadlines
+func (c *Client) VMMigrateContext(ctx context.Context, params *VMMigrateRequest) (*UPID, error) {
+	c.debug("Migrating VM", Fields{
+		"node":           params.Node,
+		"vmid":           params.VMID,
+		"target":         params.Target,
+		"online":         params.Online,
+		"withLocalDisks": params.WithLocalDisks,
+	})
+
+	p := requestParams{}
+	p.setString("target", params.Target)
+	p.setBool("online", params.Online)
+	p.setBool("with-local-disks", params.WithLocalDisks)
+	p.setString("targetstorage", storageMapping(params.TargetStorage, params.StorageMap))
+	p.setInt("bwlimit", params.BandwidthLimit)
+
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("/nodes/%s/qemu/%d/migrate", params.Node, params.VMID), p.values())
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not migrate VM")
+	}
+	return upid, nil
+}
+
+// VMMigratePreconditions checks whether a VM can be migrated, and to which nodes.
+// target is optional and limits the storage checks to that node
+func (c *Client) VMMigratePreconditions(node string, vmid int, target string) (*VMMigratePreconditions, error) {
+	return c.VMMigratePreconditionsContext(context.Background(), node, vmid, target)
+}
+
+// VMMigratePreconditionsContext is VMMigratePreconditions with a context for cancellation and deadlines
+func (c *Client) VMMigratePreconditionsContext(ctx context.Context, node string, vmid int, target string) (*VMMigratePreconditions, error) {
+	c.debug("Checking VM migration preconditions", Fields{
+		"node":   node,
+		"vmid":   vmid,
+		"target": target,
+	})
+
+	p := requestParams{}
+	p.setString("target", target)
+
+	result := &VMMigratePreconditions{}
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/qemu/%d/migrate", node, vmid), p.values(), result)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not check VM migration preconditions")
+	}
+	return result, nil
+}
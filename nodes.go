@@ -1,51 +1,57 @@
 package proxmox
 
 import (
+	"context"
 	"fmt"
-	"math"
-	"net/http"
-	"net/url"
 
 	"github.com/pkg/errors"
 )
 
-// PickNode returns node with the least provisioned memory
+// PickNode returns the node the client's Placer chooses for a guest of unknown size.
+// By default that is the online node with the most memory not provisioned to guests
 func (c *Client) PickNode() (string, error) {
-	resources, err := c.ResourceList()
-	if err != nil {
-		return "", err
-	}
-	nodes := resources.Nodes()
-	if len(nodes) < 1 {
-		return "", errors.New("no nodes found")
-	}
+	return c.PickNodeContext(context.Background())
+}
 
-	containers := resources.Containers()
+// PickNodeContext is PickNode with a context for cancellation and deadlines
+func (c *Client) PickNodeContext(ctx context.Context) (string, error) {
+	return c.PickNodeForContext(ctx, &PlacementRequest{})
+}
 
-	result := nodes[0].Node
-	mostNonProvisionedMemory := math.MinInt32
-	for _, node := range nodes {
-		nonProvisionedMemory := node.Mem
+// PickNodeFor returns the node the client's Placer chooses for the guest, out of the online
+// nodes that the request allows and that have room for it
+func (c *Client) PickNodeFor(req *PlacementRequest) (string, error) {
+	return c.PickNodeForContext(context.Background(), req)
+}
 
-		// Subtract total provisioned memory for this node
-		for _, container := range containers {
-			if container.Node == node.Node {
-				nonProvisionedMemory -= container.Mem
-			}
-		}
+// PickNodeForContext is PickNodeFor with a context for cancellation and deadlines
+func (c *Client) PickNodeForContext(ctx context.Context, req *PlacementRequest) (string, error) {
+	resources, err := c.ResourceListContext(ctx)
+	if err != nil {
+		return "", err
+	}
 
-		// Use this node if it has more non provisioned memory than the previous record
-		if nonProvisionedMemory > mostNonProvisionedMemory {
-			result = node.Node
-			mostNonProvisionedMemory = nonProvisionedMemory
-		}
+	candidates, err := placementCandidates(NodeLoads(resources, c.nodeTags), req)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not pick node")
 	}
-	return result, nil
+	load, err := c.placer.Place(candidates, req)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not pick node")
+	}
+
+	c.debug("Picked node", Fields{
+		"node":   load.Node.Node,
+		"memory": req.Memory,
+		"cores":  req.Cores,
+	})
+	return load.Node.Node, nil
 }
 
 // NodeStatus is the response from the Proxmox API
 type NodeStatus struct {
-	CPU     int `json:"cpu"`
+	// CPU, Idle and Wait are fractions of the node's CPU time
+	CPU     float64 `json:"cpu"`
 	Cpuinfo struct {
 		Cpus    int    `json:"cpus"`
 		Hvm     int    `json:"hvm"`
@@ -54,7 +60,7 @@ type NodeStatus struct {
 		Sockets int    `json:"sockets"`
 		UserHz  int    `json:"user_hz"`
 	} `json:"cpuinfo"`
-	Idle int `json:"idle"`
+	Idle float64 `json:"idle"`
 	Ksm  struct {
 		Shared int `json:"shared"`
 	} `json:"ksm"`
@@ -77,8 +83,8 @@ type NodeStatus struct {
 		Total int64 `json:"total"`
 		Used  int   `json:"used"`
 	} `json:"swap"`
-	Uptime int `json:"uptime"`
-	Wait   int `json:"wait"`
+	Uptime int     `json:"uptime"`
+	Wait   float64 `json:"wait"`
 }
 
 // NodeStatusResponse is the response from the Proxmox API for a node's status
@@ -88,33 +94,17 @@ type NodeStatusResponse struct {
 
 // NodeStatus returns the Node's RAM, CPU and storage
 func (c *Client) NodeStatus(node string) (*NodeStatus, error) {
-	log.Debugln("Getting node stats")
-
-	authed, err := c.VerifyTicket()
-	if err != nil {
-		return nil, err
-	}
+	return c.NodeStatusContext(context.Background(), node)
+}
 
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return nil, err
-		}
-	}
+// NodeStatusContext is NodeStatus with a context for cancellation and deadlines
+func (c *Client) NodeStatusContext(ctx context.Context, node string) (*NodeStatus, error) {
+	c.debug("Getting node stats", nil)
 
-	u, err := url.Parse(fmt.Sprintf("%s/api2/json/nodes/%s/status", c.host, node))
+	result := &NodeStatus{}
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/status", node), nil, result)
 	if err != nil {
-		return nil, err
-	}
-
-	proxmoxAPIResp, err := c.client.Get(u.String())
-	if proxmoxAPIResp.StatusCode != http.StatusOK {
-		err := fmt.Sprintf("Could not get node status: %s", proxmoxAPIResp.Status)
-		return nil, errors.New(err)
+		return nil, errors.Wrap(err, "Could not get node status")
 	}
-
-	proxmoxResp := &NodeStatusResponse{}
-
-	MustDecodeJSON(proxmoxAPIResp.Body, proxmoxResp)
-	return proxmoxResp.Data, nil
+	return result, nil
 }
@@ -0,0 +1,41 @@
+package proxmox
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestNodeStatus(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve1/status" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"data":{
+			"cpu": 0.0261,
+			"cpuinfo": {"cpus": 8, "hvm": 1, "mhz": "3400.000", "model": "Intel(R) Xeon(R) E-2278G", "sockets": 1, "user_hz": 100},
+			"idle": 0,
+			"ksm": {"shared": 0},
+			"kversion": "Linux 6.8.4-2-pve #1 SMP PREEMPT_DYNAMIC PMX 6.8.4-2",
+			"loadavg": ["0.21", "0.17", "0.11"],
+			"memory": {"free": 58324848640, "total": 67267567616, "used": 8942718976},
+			"pveversion": "pve-manager/8.2.2/9355359cd7afbae4",
+			"rootfs": {"avail": 84475531264, "free": 89852203008, "total": 100861726720, "used": 11009523712},
+			"swap": {"free": 8589930496, "total": 8589930496, "used": 0},
+			"uptime": 1209600,
+			"wait": 0.000312
+		}}`)
+	})
+
+	status, err := client.NodeStatus("pve1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.CPU != 0.0261 || status.Wait != 0.000312 {
+		t.Errorf("got cpu %v and wait %v, want 0.0261 and 0.000312", status.CPU, status.Wait)
+	}
+	if status.Cpuinfo.Cpus != 8 {
+		t.Errorf("got %d cpus, want 8", status.Cpuinfo.Cpus)
+	}
+}
@@ -0,0 +1,79 @@
+package proxmox
+
+// Option configures a Client, see New and NewWithToken
+type Option func(*Client)
+
+// WithCookieDomain sets the domain of the auth cookie, e.g. .example.com to share the
+// ticket between the nodes of a cluster. By default the cookie is only sent to the host
+func WithCookieDomain(domain string) Option {
+	return func(c *Client) {
+		c.cookieDomain = domain
+	}
+}
+
+// WithContainerStorage sets the storage for container root disks when a request does not name one
+func WithContainerStorage(storage string) Option {
+	return func(c *Client) {
+		c.containerStorage = storage
+	}
+}
+
+// WithVMStorage sets the storage for VM disks when a request does not name one
+func WithVMStorage(storage string) Option {
+	return func(c *Client) {
+		c.vmStorage = storage
+	}
+}
+
+// WithTemplateStorage sets the storage that holds container templates
+func WithTemplateStorage(storage string) Option {
+	return func(c *Client) {
+		c.templateStorage = storage
+	}
+}
+
+// WithISOStorage sets the storage that holds ISO images
+func WithISOStorage(storage string) Option {
+	return func(c *Client) {
+		c.isoStorage = storage
+	}
+}
+
+// WithDefaultSwap sets the swap in MB for new containers
+func WithDefaultSwap(swap int) Option {
+	return func(c *Client) {
+		c.defaultSwap = swap
+	}
+}
+
+// WithDefaultBridge sets the bridge and VLAN tag for NICs that do not name a bridge.
+// A tag of 0 leaves the NIC untagged
+func WithDefaultBridge(bridge string, tag int) Option {
+	return func(c *Client) {
+		c.defaultBridge = bridge
+		c.defaultTag = tag
+	}
+}
+
+// WithLogger sets where the client writes its debug logs. Credentials are redacted before
+// they reach the logger. By default nothing is logged
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithPlacer sets the strategy PickNode uses to choose a node. Defaults to MostFreeMemory
+func WithPlacer(placer Placer) Option {
+	return func(c *Client) {
+		c.placer = placer
+	}
+}
+
+// WithNodeTags assigns tags to nodes by name, so that PlacementRequest.Tags can limit
+// placement to nodes with particular hardware or roles
+func WithNodeTags(tags map[string][]string) Option {
+	return func(c *Client) {
+		c.nodeTags = tags
+	}
+}
@@ -0,0 +1,60 @@
+package proxmox
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// requestParams are the parameters of an API request. The setters skip empty values so that
+// optional fields of a request struct can be passed straight through, and write booleans
+// and numbers the way the Proxmox API expects them
+type requestParams url.Values
+
+// setString sets the param unless the value is empty
+func (p requestParams) setString(key, value string) {
+	if value != "" {
+		url.Values(p).Set(key, value)
+	}
+}
+
+// setInt sets the param unless the value is 0
+func (p requestParams) setInt(key string, value int) {
+	if value != 0 {
+		url.Values(p).Set(key, strconv.Itoa(value))
+	}
+}
+
+// setOptionalInt sets the param if the value is not nil, so that an explicit 0 is sent
+func (p requestParams) setOptionalInt(key string, value *int) {
+	if value != nil {
+		url.Values(p).Set(key, strconv.Itoa(*value))
+	}
+}
+
+// setBool sets the param to 1 if the value is true
+func (p requestParams) setBool(key string, value bool) {
+	if value {
+		url.Values(p).Set(key, "1")
+	}
+}
+
+// setOptionalBool sets the param to 1 or 0 if the value is not nil
+func (p requestParams) setOptionalBool(key string, value *bool) {
+	if value != nil {
+		url.Values(p).Set(key, formatBool(*value))
+	}
+}
+
+// setList sets the param to the values joined by sep, the format Proxmox uses for lists
+// like delete=net1,mp0 or tags=web;prod. Nothing is set if there are no values
+func (p requestParams) setList(key string, values []string, sep string) {
+	if len(values) > 0 {
+		url.Values(p).Set(key, strings.Join(values, sep))
+	}
+}
+
+// values returns the params for Client.Do
+func (p requestParams) values() url.Values {
+	return url.Values(p)
+}
@@ -0,0 +1,375 @@
+package proxmox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PlacementRequest describes the guest a node is picked for
+type PlacementRequest struct {
+	// Memory is in MB, Disk in GiB. Nodes without that much memory left unprovisioned, with
+	// fewer CPUs than Cores or with less free disk are skipped. Zero skips the check
+	Memory int
+	Cores  int
+	Disk   int
+	// Nodes limits placement to the named nodes. Empty allows every node
+	Nodes []string
+	// Tags limits placement to nodes that have every tag, as set with WithNodeTags
+	Tags []string
+
+	// Affinity limits placement to nodes that already run a guest of every group. A group
+	// without guests anywhere in the cluster allows every node, so that its first guest can be placed
+	Affinity []*PlacementGroup
+	// AntiAffinity limits placement to nodes that run no guest of any group
+	AntiAffinity []*PlacementGroup
+	// Spread prefers the nodes that run the fewest guests of the groups, e.g. to spread the
+	// replicas of a service over the cluster. Unlike AntiAffinity it never fails placement
+	Spread []*PlacementGroup
+}
+
+// PlacementGroup is a set of guests identified by a tag, a name prefix or both.
+// Placement fails for groups that set neither
+type PlacementGroup struct {
+	Tag        string
+	NamePrefix string
+}
+
+// empty returns true if the group sets neither a tag nor a name prefix, which would match every guest
+func (g *PlacementGroup) empty() bool {
+	return g.Tag == "" && g.NamePrefix == ""
+}
+
+// Matches returns true if the guest has the group's tag and name prefix
+func (g *PlacementGroup) Matches(guest *Resource) bool {
+	if g.Tag != "" && !containsString(guest.TagList(), g.Tag) {
+		return false
+	}
+	return strings.HasPrefix(guest.Name, g.NamePrefix)
+}
+
+// String describes the group for errors
+func (g *PlacementGroup) String() string {
+	parts := []string{}
+	if g.Tag != "" {
+		parts = append(parts, "tag "+g.Tag)
+	}
+	if g.NamePrefix != "" {
+		parts = append(parts, "name prefix "+g.NamePrefix)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// NodeLoad is an online node and the resources provisioned to the guests on it
+type NodeLoad struct {
+	Node *Resource
+	// Tags are the node's tags as set with WithNodeTags
+	Tags []string
+	// ProvisionedMemory is the configured memory of every guest on the node in bytes.
+	// Templates do not count as they never run
+	ProvisionedMemory int
+	// ProvisionedCPUs is the configured cores of every guest on the node
+	ProvisionedCPUs int
+	Guests          []*Resource
+}
+
+// FreeMemory returns the node's memory in bytes that is not provisioned to a guest
+func (l *NodeLoad) FreeMemory() int {
+	return l.Node.Maxmem - l.ProvisionedMemory
+}
+
+// FreeDisk returns the node's disk space in bytes that is not used
+func (l *NodeLoad) FreeDisk() int64 {
+	return l.Node.Maxdisk - int64(l.Node.Disk)
+}
+
+// Fits returns true if the node has enough unprovisioned memory, enough CPUs and enough free
+// disk for the guest. CPUs are commonly overcommitted, so only the guest's own cores have to
+// fit on the node. Requirements the request does not give are not checked
+func (l *NodeLoad) Fits(req *PlacementRequest) bool {
+	if req.Memory > 0 && l.FreeMemory() < req.Memory*1024*1024 {
+		return false
+	}
+	if req.Cores > 0 && l.Node.Maxcpu < req.Cores {
+		return false
+	}
+	if req.Disk > 0 && l.FreeDisk() < int64(req.Disk)*1024*1024*1024 {
+		return false
+	}
+	return true
+}
+
+// Members returns how many of the node's guests are in the group. Templates are not counted
+func (l *NodeLoad) Members(group *PlacementGroup) int {
+	result := 0
+	for _, guest := range l.Guests {
+		if guest.Template == 0 && group.Matches(guest) {
+			result++
+		}
+	}
+	return result
+}
+
+// HasTags returns true if the node has every one of the tags
+func (l *NodeLoad) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !containsString(l.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Placer chooses the node to put a new guest on. The candidates are the online nodes that
+// are allowed by the request, meet its affinity rules and have room for it, narrowed down to
+// the best spread. They are sorted by name and there is at least one
+type Placer interface {
+	Place(candidates []*NodeLoad, req *PlacementRequest) (*NodeLoad, error)
+}
+
+// NodeLoads returns the load of every online node in the resources, sorted by name
+func NodeLoads(resources Resources, nodeTags map[string][]string) []*NodeLoad {
+	loads := map[string]*NodeLoad{}
+	result := []*NodeLoad{}
+	for _, node := range resources.Nodes() {
+		if node.Status != "online" {
+			continue
+		}
+		load := &NodeLoad{Node: node, Tags: nodeTags[node.Node]}
+		loads[node.Node] = load
+		result = append(result, load)
+	}
+
+	for _, guest := range resources {
+		if guest.Type != "lxc" && guest.Type != "qemu" {
+			continue
+		}
+		load, ok := loads[guest.Node]
+		if !ok {
+			continue
+		}
+		load.Guests = append(load.Guests, guest)
+		if guest.Template == 0 {
+			load.ProvisionedMemory += guest.Maxmem
+			load.ProvisionedCPUs += guest.Maxcpu
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Node.Node < result[j].Node.Node
+	})
+	return result
+}
+
+// placementCandidates filters the loads down to the nodes the request allows and that have
+// room for it, with an error that says which requirement no node met
+func placementCandidates(loads []*NodeLoad, req *PlacementRequest) ([]*NodeLoad, error) {
+	if len(loads) == 0 {
+		return nil, errors.New("no online nodes found")
+	}
+	for _, groups := range [][]*PlacementGroup{req.Affinity, req.AntiAffinity, req.Spread} {
+		for _, group := range groups {
+			if group.empty() {
+				return nil, errors.New("placement group must have a tag or name prefix")
+			}
+		}
+	}
+
+	allowed := filterLoads(loads, func(load *NodeLoad) bool {
+		if len(req.Nodes) > 0 && !containsString(req.Nodes, load.Node.Node) {
+			return false
+		}
+		return load.HasTags(req.Tags)
+	})
+	if len(allowed) == 0 {
+		limits := []string{}
+		if len(req.Nodes) > 0 {
+			limits = append(limits, "nodes "+strings.Join(req.Nodes, ", "))
+		}
+		if len(req.Tags) > 0 {
+			limits = append(limits, "tags "+strings.Join(req.Tags, ", "))
+		}
+		return nil, fmt.Errorf("no online node matches %s", strings.Join(limits, " and "))
+	}
+
+	for _, group := range req.Affinity {
+		if clusterMembers(loads, group) == 0 {
+			continue
+		}
+		allowed = filterLoads(allowed, func(load *NodeLoad) bool {
+			return load.Members(group) > 0
+		})
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("affinity can not be satisfied, no allowed node runs a guest with %s", group)
+		}
+	}
+	for _, group := range req.AntiAffinity {
+		allowed = filterLoads(allowed, func(load *NodeLoad) bool {
+			return load.Members(group) == 0
+		})
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("anti-affinity can not be satisfied, every allowed node runs a guest with %s", group)
+		}
+	}
+
+	result := filterLoads(allowed, func(load *NodeLoad) bool {
+		return load.Fits(req)
+	})
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no allowed node has room for %d MB of memory, %d cores and %d GiB of disk", req.Memory, req.Cores, req.Disk)
+	}
+	return spreadLoads(result, req.Spread), nil
+}
+
+// clusterMembers returns how many guests of the group run on any of the nodes
+func clusterMembers(loads []*NodeLoad, group *PlacementGroup) int {
+	result := 0
+	for _, load := range loads {
+		result += load.Members(group)
+	}
+	return result
+}
+
+// filterLoads returns the loads that keep returns true for
+func filterLoads(loads []*NodeLoad, keep func(*NodeLoad) bool) []*NodeLoad {
+	result := []*NodeLoad{}
+	for _, load := range loads {
+		if keep(load) {
+			result = append(result, load)
+		}
+	}
+	return result
+}
+
+// spreadLoads returns the loads with the fewest guests in the groups
+func spreadLoads(loads []*NodeLoad, groups []*PlacementGroup) []*NodeLoad {
+	if len(groups) == 0 {
+		return loads
+	}
+
+	members := func(load *NodeLoad) int {
+		result := 0
+		for _, group := range groups {
+			result += load.Members(group)
+		}
+		return result
+	}
+
+	fewest := members(loads[0])
+	for _, load := range loads[1:] {
+		if count := members(load); count < fewest {
+			fewest = count
+		}
+	}
+	return filterLoads(loads, func(load *NodeLoad) bool {
+		return members(load) == fewest
+	})
+}
+
+// MostFreeMemory places guests on the node with the most memory not provisioned to guests
+type MostFreeMemory struct{}
+
+// Place returns the candidate with the most free memory
+func (MostFreeMemory) Place(candidates []*NodeLoad, req *PlacementRequest) (*NodeLoad, error) {
+	result := candidates[0]
+	for _, load := range candidates[1:] {
+		if load.FreeMemory() > result.FreeMemory() {
+			result = load
+		}
+	}
+	return result, nil
+}
+
+// BinPacking places guests on the fullest node that still has room, to keep other nodes free
+// for large guests or to be powered down
+type BinPacking struct{}
+
+// Place returns the candidate with the least free memory
+func (BinPacking) Place(candidates []*NodeLoad, req *PlacementRequest) (*NodeLoad, error) {
+	result := candidates[0]
+	for _, load := range candidates[1:] {
+		if load.FreeMemory() < result.FreeMemory() {
+			result = load
+		}
+	}
+	return result, nil
+}
+
+// WeightedScore places guests on the node with the most headroom, weighing the share of CPU
+// and memory left after placing the guest and the share of the node's disk that is free.
+// The zero value weighs all three equally
+type WeightedScore struct {
+	CPU    float64
+	Memory float64
+	Disk   float64
+}
+
+// Place returns the candidate with the highest score
+func (w WeightedScore) Place(candidates []*NodeLoad, req *PlacementRequest) (*NodeLoad, error) {
+	result := candidates[0]
+	best := w.score(result, req)
+	for _, load := range candidates[1:] {
+		score := w.score(load, req)
+		if score > best {
+			result = load
+			best = score
+		}
+	}
+	return result, nil
+}
+
+// score returns the weighted sum of the node's free CPU, memory and disk as fractions
+func (w WeightedScore) score(load *NodeLoad, req *PlacementRequest) float64 {
+	if w.CPU == 0 && w.Memory == 0 && w.Disk == 0 {
+		w = WeightedScore{CPU: 1, Memory: 1, Disk: 1}
+	}
+
+	node := load.Node
+	return w.CPU*freeShare(float64(load.ProvisionedCPUs+req.Cores), float64(node.Maxcpu)) +
+		w.Memory*freeShare(float64(load.ProvisionedMemory+req.Memory*1024*1024), float64(node.Maxmem)) +
+		w.Disk*freeShare(float64(int64(node.Disk)+int64(req.Disk)*1024*1024*1024), float64(node.Maxdisk))
+}
+
+// freeShare returns the unused fraction of total, which is negative when it is overcommitted
+func freeShare(used, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return 1 - used/total
+}
+
+// RoundRobin places guests on each candidate in turn, in order of node name.
+// It is safe for concurrent use
+type RoundRobin struct {
+	mu   sync.Mutex
+	last string
+}
+
+// Place returns the first candidate after the node it placed the previous guest on
+func (r *RoundRobin) Place(candidates []*NodeLoad, req *PlacementRequest) (*NodeLoad, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := candidates[0]
+	for _, load := range candidates {
+		if load.Node.Node > r.last {
+			result = load
+			break
+		}
+	}
+	r.last = result.Node.Node
+	return result, nil
+}
+
+// containsString returns true if the value is in the list
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package proxmox
+
+import "testing"
+
+const gib = 1024 * 1024 * 1024
+
+// testCluster is three online nodes with 32 GiB of memory and 8 CPUs each, running two web
+// guests on pve1, one web and one db guest on pve2 and nothing on pve3
+func testCluster() []*NodeLoad {
+	return NodeLoads(Resources{
+		{Type: "node", Node: "pve1", Status: "online", Maxmem: 32 * gib, Maxcpu: 8, Maxdisk: 100 * gib, Disk: 20 * gib},
+		{Type: "node", Node: "pve2", Status: "online", Maxmem: 32 * gib, Maxcpu: 8, Maxdisk: 100 * gib, Disk: 90 * gib},
+		{Type: "node", Node: "pve3", Status: "online", Maxmem: 32 * gib, Maxcpu: 8, Maxdisk: 100 * gib, Disk: 50 * gib},
+		{Type: "qemu", Node: "pve1", Vmid: 100, Name: "web-1", Tags: "web", Maxmem: 4 * gib, Maxcpu: 2},
+		{Type: "lxc", Node: "pve1", Vmid: 101, Name: "web-2", Tags: "web", Maxmem: 4 * gib, Maxcpu: 2},
+		{Type: "qemu", Node: "pve2", Vmid: 102, Name: "web-3", Tags: "web", Maxmem: 4 * gib, Maxcpu: 2},
+		{Type: "qemu", Node: "pve2", Vmid: 103, Name: "db-1", Tags: "db", Maxmem: 16 * gib, Maxcpu: 4},
+	}, nil)
+}
+
+// nodeNames returns the names of the loads' nodes
+func nodeNames(loads []*NodeLoad) []string {
+	result := []string{}
+	for _, load := range loads {
+		result = append(result, load.Node.Node)
+	}
+	return result
+}
+
+// assertNodes checks the loads are the named nodes, in order
+func assertNodes(t *testing.T, got []*NodeLoad, want ...string) {
+	t.Helper()
+
+	names := nodeNames(got)
+	if len(names) != len(want) {
+		t.Fatalf("got nodes %v, want %v", names, want)
+	}
+	for i := range names {
+		if names[i] != want[i] {
+			t.Fatalf("got nodes %v, want %v", names, want)
+		}
+	}
+}
+
+func TestPlacementAffinity(t *testing.T) {
+	tests := []struct {
+		name     string
+		affinity []*PlacementGroup
+		want     []string
+	}{
+		{
+			name:     "group with guests",
+			affinity: []*PlacementGroup{{Tag: "db"}},
+			want:     []string{"pve2"},
+		},
+		{
+			name:     "group without guests",
+			affinity: []*PlacementGroup{{Tag: "cache"}},
+			want:     []string{"pve1", "pve2", "pve3"},
+		},
+		{
+			name:     "group with and group without guests",
+			affinity: []*PlacementGroup{{Tag: "web"}, {NamePrefix: "cache-"}},
+			want:     []string{"pve1", "pve2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := placementCandidates(testCluster(), &PlacementRequest{Affinity: tt.affinity})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertNodes(t, got, tt.want...)
+		})
+	}
+}
+
+func TestPlacementAffinityOutsideAllowedNodes(t *testing.T) {
+	// The group has a guest, just not on a node the request allows
+	_, err := placementCandidates(testCluster(), &PlacementRequest{
+		Nodes:    []string{"pve1", "pve3"},
+		Affinity: []*PlacementGroup{{Tag: "db"}},
+	})
+	if err == nil {
+		t.Fatal("got no error, want affinity to fail")
+	}
+}
+
+func TestPlacementAntiAffinity(t *testing.T) {
+	got, err := placementCandidates(testCluster(), &PlacementRequest{
+		AntiAffinity: []*PlacementGroup{{Tag: "web"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNodes(t, got, "pve3")
+}
+
+func TestPlacementRejectsEmptyGroup(t *testing.T) {
+	_, err := placementCandidates(testCluster(), &PlacementRequest{
+		Spread: []*PlacementGroup{{}},
+	})
+	if err == nil {
+		t.Fatal("got no error, want the empty group rejected")
+	}
+}
+
+func TestSpreadLoads(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []*PlacementGroup
+		want   []string
+	}{
+		{
+			name: "no groups",
+			want: []string{"pve1", "pve2", "pve3"},
+		},
+		{
+			name:   "one group",
+			groups: []*PlacementGroup{{Tag: "db"}},
+			want:   []string{"pve1", "pve3"},
+		},
+		{
+			name:   "groups are counted together",
+			groups: []*PlacementGroup{{Tag: "web"}, {Tag: "db"}},
+			want:   []string{"pve3"},
+		},
+		{
+			name:   "name prefix",
+			groups: []*PlacementGroup{{NamePrefix: "web-"}},
+			want:   []string{"pve3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertNodes(t, spreadLoads(testCluster(), tt.groups), tt.want...)
+		})
+	}
+}
+
+func TestWeightedScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		placer WeightedScore
+		want   string
+	}{
+		{
+			// pve3 has the most headroom overall even though pve1 has more free disk
+			name: "zero value weighs equally",
+			want: "pve3",
+		},
+		{
+			name:   "disk only",
+			placer: WeightedScore{Disk: 1},
+			want:   "pve1",
+		},
+		{
+			name:   "memory only",
+			placer: WeightedScore{Memory: 1},
+			want:   "pve3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.placer.Place(testCluster(), &PlacementRequest{Memory: 1024, Cores: 1, Disk: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Node.Node != tt.want {
+				t.Errorf("got %s, want %s", got.Node.Node, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeLoads(t *testing.T) {
+	loads := NodeLoads(Resources{
+		{Type: "node", Node: "pve2", Status: "online", Maxmem: 32 * gib},
+		{Type: "node", Node: "pve1", Status: "online", Maxmem: 32 * gib},
+		{Type: "node", Node: "pve3", Status: "offline", Maxmem: 32 * gib},
+		{Type: "storage", Node: "pve1", Storage: "local-lvm"},
+		{Type: "qemu", Node: "pve1", Vmid: 100, Maxmem: 4 * gib, Maxcpu: 2},
+		{Type: "lxc", Node: "pve1", Vmid: 101, Maxmem: 1 * gib, Maxcpu: 1},
+		{Type: "qemu", Node: "pve1", Vmid: 9000, Maxmem: 8 * gib, Maxcpu: 4, Template: 1},
+		{Type: "qemu", Node: "pve3", Vmid: 102, Maxmem: 4 * gib, Maxcpu: 2},
+	}, map[string][]string{"pve1": {"ssd"}})
+
+	assertNodes(t, loads, "pve1", "pve2")
+
+	pve1 := loads[0]
+	if pve1.ProvisionedMemory != 5*gib || pve1.ProvisionedCPUs != 3 {
+		t.Errorf("got %d bytes and %d cores provisioned, want templates left out", pve1.ProvisionedMemory, pve1.ProvisionedCPUs)
+	}
+	if len(pve1.Guests) != 3 {
+		t.Errorf("got %d guests, want 3 including the template", len(pve1.Guests))
+	}
+	if pve1.FreeMemory() != 27*gib {
+		t.Errorf("got %d bytes free, want %d", pve1.FreeMemory(), 27*gib)
+	}
+	if !pve1.HasTags([]string{"ssd"}) || loads[1].HasTags([]string{"ssd"}) {
+		t.Error("got the ssd tag on the wrong node")
+	}
+}
+
+func TestNodeLoadFits(t *testing.T) {
+	// pve2 has 8 CPUs, 12 GiB of memory left to provision and 10 GiB of disk free
+	load := testCluster()[1]
+
+	tests := []struct {
+		name string
+		req  PlacementRequest
+		want bool
+	}{
+		{name: "no requirements", want: true},
+		{name: "everything fits", req: PlacementRequest{Memory: 12 * 1024, Cores: 8, Disk: 10}, want: true},
+		{name: "too much memory", req: PlacementRequest{Memory: 12*1024 + 1}},
+		{name: "more cores than the node has", req: PlacementRequest{Cores: 9}},
+		{name: "too much disk", req: PlacementRequest{Disk: 11}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := load.Fits(&tt.req); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlacementFitsError(t *testing.T) {
+	_, err := placementCandidates(testCluster(), &PlacementRequest{Memory: 64 * 1024})
+	if err == nil {
+		t.Fatal("got no error, want no node to fit")
+	}
+}
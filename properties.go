@@ -0,0 +1,196 @@
+package proxmox
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// propertyString is a parsed Proxmox property string, the comma separated key=value format
+// used for most config values, e.g. local-lvm:vm-100-disk-0,cache=writeback,size=32G.
+// The first value may omit its key, in which case it belongs to the format's default key
+type propertyString map[string]string
+
+// parsePropertyString splits a property string into its keys and values
+func parsePropertyString(s, defaultKey string) (propertyString, error) {
+	result := propertyString{}
+	if s == "" {
+		return result, nil
+	}
+
+	for i, part := range strings.Split(s, ",") {
+		key, value := defaultKey, part
+		if idx := strings.Index(part, "="); idx >= 0 {
+			key, value = part[:idx], part[idx+1:]
+		} else if i > 0 || defaultKey == "" {
+			return nil, fmt.Errorf("invalid property %q in %q", part, s)
+		}
+
+		if _, ok := result[key]; ok {
+			return nil, fmt.Errorf("duplicate property %q in %q", key, s)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// format returns the properties the way Proxmox writes them, with the default key's value first
+// and without its key, then the remaining keys in alphabetical order
+func (ps propertyString) format(defaultKey string) string {
+	parts := []string{}
+	if value, ok := ps[defaultKey]; ok && defaultKey != "" {
+		parts = append(parts, value)
+	}
+
+	keys := make([]string, 0, len(ps))
+	for key := range ps {
+		if key != defaultKey || defaultKey == "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		parts = append(parts, key+"="+ps[key])
+	}
+	return strings.Join(parts, ",")
+}
+
+// take removes a key and returns its value
+func (ps propertyString) take(key string) string {
+	value := ps[key]
+	delete(ps, key)
+	return value
+}
+
+// takeInt removes a key and returns its value as an int, or 0 if it is not set
+func (ps propertyString) takeInt(key string) (int, error) {
+	value := ps.take(key)
+	if value == "" {
+		return 0, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return result, nil
+}
+
+// takeBool returns a key's value as a bool. True values are removed, while values that are
+// off stay in the properties so that an explicit 0 survives a round trip
+func (ps propertyString) takeBool(key string) bool {
+	if !parseBool(ps[key]) {
+		return false
+	}
+	delete(ps, key)
+	return true
+}
+
+// takeOptionalBool removes a key and returns its value as a bool, or nil if it is not set.
+// This is for flags that default to on, where an explicit 0 has to survive a round trip
+func (ps propertyString) takeOptionalBool(key string) *bool {
+	value, ok := ps[key]
+	if !ok {
+		return nil
+	}
+	delete(ps, key)
+	result := parseBool(value)
+	return &result
+}
+
+// setString sets the key unless the value is empty
+func (ps propertyString) setString(key, value string) {
+	if value != "" {
+		ps[key] = value
+	}
+}
+
+// setInt sets the key unless the value is 0
+func (ps propertyString) setInt(key string, value int) {
+	if value != 0 {
+		ps[key] = strconv.Itoa(value)
+	}
+}
+
+// setBool sets the key to 1 if the value is true
+func (ps propertyString) setBool(key string, value bool) {
+	if value {
+		ps[key] = "1"
+	}
+}
+
+// setOptionalBool sets the key to 1 or 0 if the value is not nil
+func (ps propertyString) setOptionalBool(key string, value *bool) {
+	if value != nil {
+		ps[key] = formatBool(*value)
+	}
+}
+
+// copyProperties returns a copy of the properties that can be modified without changing the original
+func copyProperties(props map[string]string) propertyString {
+	result := propertyString{}
+	for key, value := range props {
+		result[key] = value
+	}
+	return result
+}
+
+// parseBool accepts every spelling of a boolean that Proxmox does
+func parseBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "on", "yes", "true":
+		return true
+	}
+	return false
+}
+
+// formatBool returns a boolean the way Proxmox writes it
+func formatBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+// Startup is the start and shutdown order of a guest, e.g. order=1,up=30,down=60
+type Startup struct {
+	Order int
+	// Up and Down are the delays in seconds after starting and before stopping the guest
+	Up      int
+	Down    int
+	Options map[string]string
+}
+
+// ParseStartup will convert a proxmox startup property string into a struct
+func ParseStartup(s string) (*Startup, error) {
+	ps, err := parsePropertyString(s, "order")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Startup{}
+	result.Order, err = ps.takeInt("order")
+	if err != nil {
+		return nil, err
+	}
+	result.Up, err = ps.takeInt("up")
+	if err != nil {
+		return nil, err
+	}
+	result.Down, err = ps.takeInt("down")
+	if err != nil {
+		return nil, err
+	}
+	result.Options = ps
+	return result, nil
+}
+
+// String returns the startup order in Proxmox's property string format
+func (s *Startup) String() string {
+	ps := copyProperties(s.Options)
+	ps.setInt("order", s.Order)
+	ps.setInt("up", s.Up)
+	ps.setInt("down", s.Down)
+	return ps.format("")
+}
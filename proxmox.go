@@ -1,38 +1,115 @@
 package proxmox
 
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+)
+
 // NextIDResponse is the next available VMID from the Proxmox API
 type NextIDResponse struct {
 	Data string `json:"data"`
 }
 
-// Service contains the methods that the proxmox client provides
+// Service contains the methods that the proxmox client provides.
+// Every method has a Context variant which passes cancellation and deadlines to the HTTP request
 type Service interface {
 	SignIn() error
+	SignInContext(ctx context.Context) error
 	VerifyTicket() (bool, error)
+	VerifyTicketContext(ctx context.Context) (bool, error)
 	ResourceList() (Resources, error)
+	ResourceListContext(ctx context.Context) (Resources, error)
 
 	PickNode() (string, error)
+	PickNodeContext(ctx context.Context) (string, error)
+	PickNodeFor(*PlacementRequest) (string, error)
+	PickNodeForContext(context.Context, *PlacementRequest) (string, error)
 
-	ContainerCreate(*ContainerCreateRequest) error
-	ContainerStop(*ContainerVMStatusRequest) error
-	ContainerStart(*ContainerVMStatusRequest) error
-	ContainerShutdown(*ContainerVMStatusRequest) error
-	ContainerResume(*ContainerVMStatusRequest) error
-	ContainerDelete(node string, vmid int) error
+	ContainerCreate(*ContainerCreateRequest) (*UPID, error)
+	ContainerCreateContext(context.Context, *ContainerCreateRequest) (*UPID, error)
+	ContainerStop(*ContainerVMStatusRequest) (*UPID, error)
+	ContainerStopContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	ContainerStart(*ContainerVMStatusRequest) (*UPID, error)
+	ContainerStartContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	ContainerShutdown(*ContainerVMStatusRequest) (*UPID, error)
+	ContainerShutdownContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	ContainerResume(*ContainerVMStatusRequest) (*UPID, error)
+	ContainerResumeContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	ContainerDelete(node string, vmid int) (*UPID, error)
+	ContainerDeleteContext(ctx context.Context, node string, vmid int) (*UPID, error)
+	ContainerUpdate(*ContainerUpdateRequest) error
+	ContainerUpdateContext(context.Context, *ContainerUpdateRequest) error
 	ContainerConfig(*ContainerConfigRequest) (*ContainerConfig, error)
+	ContainerConfigContext(context.Context, *ContainerConfigRequest) (*ContainerConfig, error)
+
+	VMDelete(node string, vmid int) (*UPID, error)
+	VMDeleteContext(ctx context.Context, node string, vmid int) (*UPID, error)
+	VMConfig(*VMConfigRequest) (*VMConfig, error)
+	VMConfigContext(context.Context, *VMConfigRequest) (*VMConfig, error)
+	VMUpdate(node string, vmid int, config *VMConfig) error
+	VMUpdateContext(ctx context.Context, node string, vmid int, config *VMConfig) error
+	VMCreate(*VMCreateRequest) (*UPID, error)
+	VMCreateContext(context.Context, *VMCreateRequest) (*UPID, error)
+	VMStop(*ContainerVMStatusRequest) (*UPID, error)
+	VMStopContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	VMStart(*ContainerVMStatusRequest) (*UPID, error)
+	VMStartContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	VMShutdown(*ContainerVMStatusRequest) (*UPID, error)
+	VMShutdownContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	VMResume(*ContainerVMStatusRequest) (*UPID, error)
+	VMResumeContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	VMSuspend(*ContainerVMStatusRequest) (*UPID, error)
+	VMSuspendContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+	VMReset(*ContainerVMStatusRequest) (*UPID, error)
+	VMResetContext(context.Context, *ContainerVMStatusRequest) (*UPID, error)
+
+	ContainerClone(*ContainerCloneRequest) (*UPID, error)
+	ContainerCloneContext(context.Context, *ContainerCloneRequest) (*UPID, error)
+	VMClone(*VMCloneRequest) (*UPID, error)
+	VMCloneContext(context.Context, *VMCloneRequest) (*UPID, error)
+	ConvertToTemplate(*ConvertToTemplateRequest) (*UPID, error)
+	ConvertToTemplateContext(context.Context, *ConvertToTemplateRequest) (*UPID, error)
+
+	ContainerMigrate(*ContainerMigrateRequest) (*UPID, error)
+	ContainerMigrateContext(context.Context, *ContainerMigrateRequest) (*UPID, error)
+	VMMigrate(*VMMigrateRequest) (*UPID, error)
+	VMMigrateContext(context.Context, *VMMigrateRequest) (*UPID, error)
+	VMMigratePreconditions(node string, vmid int, target string) (*VMMigratePreconditions, error)
+	VMMigratePreconditionsContext(ctx context.Context, node string, vmid int, target string) (*VMMigratePreconditions, error)
 
-	// VMDelete(node string, vmid int) error
-	// VMConfig(*VMConfigRequest) (*VMConfig, error)
-	// VMCreate(*VMCreateRequest) error
-	// VMStop(*ContainerVMStatusRequest) error
-	// VMStart(*ContainerVMStatusRequest) error
-	// VMShutdown(*ContainerVMStatusRequest) error
-	// VMResume(*ContainerVMStatusRequest) error
-	// VMSuspend(*ContainerVMStatusRequest) error
-	// VMReset(*ContainerVMStatusRequest) error
+	SnapshotList(*SnapshotListRequest) ([]*Snapshot, error)
+	SnapshotListContext(context.Context, *SnapshotListRequest) ([]*Snapshot, error)
+	SnapshotTree(*SnapshotListRequest) ([]*SnapshotNode, error)
+	SnapshotTreeContext(context.Context, *SnapshotListRequest) ([]*SnapshotNode, error)
+	SnapshotCreate(*SnapshotCreateRequest) (*UPID, error)
+	SnapshotCreateContext(context.Context, *SnapshotCreateRequest) (*UPID, error)
+	SnapshotRollback(*SnapshotRequest) (*UPID, error)
+	SnapshotRollbackContext(context.Context, *SnapshotRequest) (*UPID, error)
+	SnapshotDelete(*SnapshotRequest) (*UPID, error)
+	SnapshotDeleteContext(context.Context, *SnapshotRequest) (*UPID, error)
+	SnapshotConfig(*SnapshotRequest) (map[string]string, error)
+	SnapshotConfigContext(context.Context, *SnapshotRequest) (map[string]string, error)
 
 	TemplateList(node string) ([]*Template, error)
+	TemplateListContext(ctx context.Context, node string) ([]*Template, error)
 	ISOList(node string) ([]string, error)
+	ISOListContext(ctx context.Context, node string) ([]string, error)
+
+	TaskStatus(upid *UPID) (*TaskStatus, error)
+	TaskStatusContext(ctx context.Context, upid *UPID) (*TaskStatus, error)
+	WaitForTask(ctx context.Context, upid *UPID, pollInterval time.Duration) (*TaskStatus, error)
+	TaskLog(upid *UPID, start, limit int) ([]*TaskLogLine, error)
+	TaskLogContext(ctx context.Context, upid *UPID, start, limit int) ([]*TaskLogLine, error)
+	TaskLogReader(ctx context.Context, upid *UPID, pollInterval time.Duration) io.ReadCloser
 
 	NextID() (int, error)
+	NextIDContext(ctx context.Context) (int, error)
+	VMIDAvailable(vmid int) (bool, error)
+	VMIDAvailableContext(ctx context.Context, vmid int) (bool, error)
+
+	Do(ctx context.Context, method, path string, params url.Values, out interface{}) error
 }
+
+var _ Service = (*Client)(nil)
@@ -0,0 +1,78 @@
+package proxmox
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the value of anything secret before it is logged
+const redacted = "[redacted]"
+
+// sensitiveKeys are the log fields, API params, headers and JSON keys that hold credentials,
+// lower cased and without separators
+var sensitiveKeys = map[string]bool{
+	"password":            true,
+	"sshpublickey":        true,
+	"sshpublickeys":       true,
+	"ticket":              true,
+	"csrfpreventiontoken": true,
+	"csrftoken":           true,
+	"authorization":       true,
+	"cookie":              true,
+	"setcookie":           true,
+	"secret":              true,
+	"tokensecret":         true,
+}
+
+// isSensitive returns true if the key holds a credential, in any spelling such as
+// Password, ssh-public-keys or CSRFPreventionToken
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	key = strings.NewReplacer("-", "", "_", "").Replace(key)
+	return sensitiveKeys[key]
+}
+
+// redactFields returns a copy of the log fields with the values of sensitive keys replaced
+func redactFields(fields Fields) Fields {
+	if fields == nil {
+		return nil
+	}
+	result := Fields{}
+	for key, value := range fields {
+		if isSensitive(key) {
+			value = redacted
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// redactValues returns a copy of the request params with the values of sensitive keys replaced
+func redactValues(values url.Values) url.Values {
+	result := url.Values{}
+	for key, value := range values {
+		if isSensitive(key) {
+			value = []string{redacted}
+		}
+		result[key] = value
+	}
+	return result
+}
+
+var (
+	// sensitiveHeader matches a credential header line of a dumped request or response
+	sensitiveHeader = regexp.MustCompile(`(?im)^(authorization|cookie|set-cookie|csrfpreventiontoken):.*$`)
+	// sensitiveJSON matches a credential in a JSON body, e.g. "ticket":"PVE:root@pam:..."
+	sensitiveJSON = regexp.MustCompile(`(?i)"(password|ticket|csrfpreventiontoken|ssh-public-keys)"\s*:\s*"(\\.|[^"\\])*"`)
+	// sensitiveForm matches a credential in a form encoded body or query string
+	sensitiveForm = regexp.MustCompile(`(?i)\b(password|ssh-public-keys)=[^&\s]*`)
+)
+
+// redactDump replaces credentials in the headers and body of a dumped request or response
+func redactDump(dump string) string {
+	dump = sensitiveHeader.ReplaceAllString(dump, "$1: "+redacted)
+	dump = sensitiveJSON.ReplaceAllString(dump, `"$1":"`+redacted+`"`)
+	dump = sensitiveForm.ReplaceAllString(dump, "$1="+redacted)
+	return dump
+}
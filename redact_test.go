@@ -0,0 +1,47 @@
+package proxmox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactDump(t *testing.T) {
+	tests := []struct {
+		name   string
+		dump   string
+		secret string
+	}{
+		{
+			name:   "cookie header",
+			dump:   "HTTP/1.1 200 OK\r\nSet-Cookie: PVEAuthCookie=PVE:root@pam:4EEC61E2::c2lnbmF0dXJl\r\n\r\n",
+			secret: "c2lnbmF0dXJl",
+		},
+		{
+			name:   "token header",
+			dump:   "GET /api2/json/version HTTP/1.1\r\nAuthorization: PVEAPIToken=root@pam!ci=0b3e1d6c-5a2f\r\n\r\n",
+			secret: "0b3e1d6c-5a2f",
+		},
+		{
+			name:   "ticket in json",
+			dump:   `{"data":{"CSRFPreventionToken":"4EEC61E2:dG9rZW4","ticket":"PVE:root@pam:4EEC61E2::c2lnbmF0dXJl","username":"root@pam"}}`,
+			secret: "4EEC61E2",
+		},
+		{
+			name:   "password in form",
+			dump:   "POST /api2/json/access/ticket HTTP/1.1\r\n\r\nusername=root%40pam&password=hunter2",
+			secret: "hunter2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactDump(tt.dump)
+			if strings.Contains(got, tt.secret) {
+				t.Errorf("got %q, want %q redacted", got, tt.secret)
+			}
+			if !strings.Contains(got, redacted) {
+				t.Errorf("got %q, want it to contain %q", got, redacted)
+			}
+		})
+	}
+}
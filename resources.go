@@ -1,10 +1,9 @@
 package proxmox
 
 import (
-	"fmt"
-	"net/http"
-	"net/url"
+	"context"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -31,6 +30,14 @@ type Resource struct {
 	Vmid      int     `json:"vmid,omitempty"`
 	Level     string  `json:"level,omitempty"`
 	Storage   string  `json:"storage,omitempty"`
+	Tags      string  `json:"tags,omitempty"`
+}
+
+// TagList returns the guest's tags, which Proxmox separates with semicolons
+func (r *Resource) TagList() []string {
+	return strings.FieldsFunc(r.Tags, func(c rune) bool {
+		return c == ';' || c == ',' || c == ' '
+	})
 }
 
 // Resources is a list of resources from the Proxmox API
@@ -106,33 +113,19 @@ func (pr Resources) Nodes() []*Resource {
 
 // ResourceList runs the List action for the Proxmox resources
 func (c *Client) ResourceList() (Resources, error) {
-	log.Debugln("Getting resources from cluster")
-
-	authed, err := c.VerifyTicket()
-	if err != nil {
-		return nil, err
-	}
+	return c.ResourceListContext(context.Background())
+}
 
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return nil, err
-		}
-	}
+// ResourceListContext is ResourceList with a context for cancellation and deadlines
+func (c *Client) ResourceListContext(ctx context.Context) (Resources, error) {
+	c.debug("Getting resources from cluster", nil)
 
-	u, err := url.Parse(fmt.Sprintf("%s/api2/json/cluster/resources", c.host))
+	var result Resources
+	err := c.Do(ctx, "GET", "/cluster/resources", nil, &result)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "Could not get node list")
 	}
-	proxmoxAPIResp, err := c.client.Get(u.String())
-	if proxmoxAPIResp.StatusCode != http.StatusOK {
-		err := fmt.Sprintf("Could not get node list: %s", proxmoxAPIResp.Status)
-		return nil, errors.New(err)
-	}
-	proxmoxResp := &ResourcesResponse{}
-
-	MustDecodeJSON(proxmoxAPIResp.Body, proxmoxResp)
-	return Resources(proxmoxResp.Data), nil
+	return result, nil
 }
 
 // ResourcesResponse is a list of Resources from the Proxmox API
@@ -0,0 +1,35 @@
+//go:build go1.21
+// +build go1.21
+
+package proxmox
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+// slogLogger logs to a log/slog logger
+type slogLogger struct {
+	log *slog.Logger
+}
+
+// NewSlogLogger returns a Logger that writes to a log/slog logger
+func NewSlogLogger(log *slog.Logger) Logger {
+	return &slogLogger{log: log}
+}
+
+// Debug logs the message and fields at debug level, with the fields in alphabetical order
+func (l *slogLogger) Debug(msg string, fields Fields) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, fields[key]))
+	}
+	l.log.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
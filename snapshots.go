@@ -0,0 +1,267 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Guest types as they appear in API paths and in Resource.Type
+const (
+	GuestTypeContainer = "lxc"
+	GuestTypeVM        = "qemu"
+)
+
+// guestPath returns the API path of a container or VM
+func guestPath(guestType, node string, vmid int) (string, error) {
+	if guestType != GuestTypeContainer && guestType != GuestTypeVM {
+		return "", fmt.Errorf("invalid guest type %q, must be %s or %s", guestType, GuestTypeContainer, GuestTypeVM)
+	}
+	return fmt.Sprintf("/nodes/%s/%s/%d", node, guestType, vmid), nil
+}
+
+// currentSnapshot is the name of the entry Proxmox adds to the snapshot list for the guest's
+// running state. Its parent is the snapshot the guest was last rolled back to or taken from
+const currentSnapshot = "current"
+
+// Snapshot is a snapshot of a container or VM
+type Snapshot struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parent      string `json:"parent,omitempty"`
+	SnapTime    int64  `json:"snaptime,omitempty"`
+	// VMState is 1 if the snapshot includes the RAM of a running VM
+	VMState int `json:"vmstate,omitempty"`
+	// Running is only set on the current entry
+	Running int `json:"running,omitempty"`
+}
+
+// Current returns true for the entry that stands for the guest's running state
+func (s *Snapshot) Current() bool {
+	return s.Name == currentSnapshot
+}
+
+// SnapshotNode is a snapshot and the snapshots taken from it
+type SnapshotNode struct {
+	*Snapshot
+	Children []*SnapshotNode
+}
+
+// BuildSnapshotTree links the snapshots by their parents and returns the roots. Children are
+// in the order they were taken, with the current entry last. Snapshots whose parent is
+// missing from the list become roots
+func BuildSnapshotTree(snapshots []*Snapshot) []*SnapshotNode {
+	sorted := make([]*Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Current() != sorted[j].Current() {
+			return !sorted[i].Current()
+		}
+		return sorted[i].SnapTime < sorted[j].SnapTime
+	})
+
+	nodes := map[string]*SnapshotNode{}
+	for _, snapshot := range sorted {
+		nodes[snapshot.Name] = &SnapshotNode{Snapshot: snapshot}
+	}
+
+	roots := []*SnapshotNode{}
+	for _, snapshot := range sorted {
+		node := nodes[snapshot.Name]
+		parent, ok := nodes[snapshot.Parent]
+		if !ok || snapshot.Parent == "" {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	return roots
+}
+
+// SnapshotListRequest is a request to the Proxmox API for a guest's snapshots
+type SnapshotListRequest struct {
+	// Type is GuestTypeContainer or GuestTypeVM
+	Type string
+	Node string
+	VMID int
+}
+
+// SnapshotRequest is a request to the Proxmox API for a single snapshot of a guest
+type SnapshotRequest struct {
+	// Type is GuestTypeContainer or GuestTypeVM
+	Type string
+	Node string
+	VMID int
+	Name string
+}
+
+// SnapshotCreateRequest is a request to the Proxmox API to snapshot a guest
+type SnapshotCreateRequest struct {
+	// Type is GuestTypeContainer or GuestTypeVM
+	Type        string
+	Node        string
+	VMID        int
+	Name        string
+	Description string
+	// VMState includes the RAM of a running VM so it resumes where it was on rollback. qemu only
+	VMState bool
+}
+
+// SnapshotList returns the guest's snapshots, including the current entry for its running state
+func (c *Client) SnapshotList(params *SnapshotListRequest) ([]*Snapshot, error) {
+	return c.SnapshotListContext(context.Background(), params)
+}
+
+// SnapshotListContext is SnapshotList with a context for cancellation and deadlines
+func (c *Client) SnapshotListContext(ctx context.Context, params *SnapshotListRequest) ([]*Snapshot, error) {
+	c.debug("Getting snapshots", Fields{
+		"type": params.Type,
+		"node": params.Node,
+		"vmid": params.VMID,
+	})
+
+	path, err := guestPath(params.Type, params.Node, params.VMID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Snapshot
+	err = c.Do(ctx, "GET", path+"/snapshot", nil, &result)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get snapshots")
+	}
+	return result, nil
+}
+
+// SnapshotTree returns the guest's snapshots as a tree built by BuildSnapshotTree
+func (c *Client) SnapshotTree(params *SnapshotListRequest) ([]*SnapshotNode, error) {
+	return c.SnapshotTreeContext(context.Background(), params)
+}
+
+// SnapshotTreeContext is SnapshotTree with a context for cancellation and deadlines
+func (c *Client) SnapshotTreeContext(ctx context.Context, params *SnapshotListRequest) ([]*SnapshotNode, error) {
+	snapshots, err := c.SnapshotListContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return BuildSnapshotTree(snapshots), nil
+}
+
+// SnapshotCreate takes a snapshot of the guest
+func (c *Client) SnapshotCreate(params *SnapshotCreateRequest) (*UPID, error) {
+	return c.SnapshotCreateContext(context.Background(), params)
+}
+
+// SnapshotCreateContext is SnapshotCreate with a context for cancellation and deadlines
+func (c *Client) SnapshotCreateContext(ctx context.Context, params *SnapshotCreateRequest) (*UPID, error) {
+	c.debug("Creating snapshot", Fields{
+		"type":    params.Type,
+		"node":    params.Node,
+		"vmid":    params.VMID,
+		"name":    params.Name,
+		"vmstate": params.VMState,
+	})
+
+	path, err := guestPath(params.Type, params.Node, params.VMID)
+	if err != nil {
+		return nil, err
+	}
+	if params.VMState && params.Type != GuestTypeVM {
+		return nil, errors.New("vmstate is only supported for VMs")
+	}
+
+	p := requestParams{}
+	p.setString("snapname", params.Name)
+	p.setString("description", params.Description)
+	p.setBool("vmstate", params.VMState)
+
+	upid, err := c.doTask(ctx, "POST", path+"/snapshot", p.values())
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create snapshot")
+	}
+	return upid, nil
+}
+
+// SnapshotRollback reverts the guest to the snapshot
+func (c *Client) SnapshotRollback(params *SnapshotRequest) (*UPID, error) {
+	return c.SnapshotRollbackContext(context.Background(), params)
+}
+
+// SnapshotRollbackContext is SnapshotRollback with a context for cancellation and deadlines
+func (c *Client) SnapshotRollbackContext(ctx context.Context, params *SnapshotRequest) (*UPID, error) {
+	c.debug("Rolling back snapshot", Fields{
+		"type": params.Type,
+		"node": params.Node,
+		"vmid": params.VMID,
+		"name": params.Name,
+	})
+
+	path, err := guestPath(params.Type, params.Node, params.VMID)
+	if err != nil {
+		return nil, err
+	}
+
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("%s/snapshot/%s/rollback", path, url.PathEscape(params.Name)), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not roll back snapshot")
+	}
+	return upid, nil
+}
+
+// SnapshotDelete removes the snapshot. The guest and the other snapshots are not changed
+func (c *Client) SnapshotDelete(params *SnapshotRequest) (*UPID, error) {
+	return c.SnapshotDeleteContext(context.Background(), params)
+}
+
+// SnapshotDeleteContext is SnapshotDelete with a context for cancellation and deadlines
+func (c *Client) SnapshotDeleteContext(ctx context.Context, params *SnapshotRequest) (*UPID, error) {
+	c.debug("Deleting snapshot", Fields{
+		"type": params.Type,
+		"node": params.Node,
+		"vmid": params.VMID,
+		"name": params.Name,
+	})
+
+	path, err := guestPath(params.Type, params.Node, params.VMID)
+	if err != nil {
+		return nil, err
+	}
+
+	upid, err := c.doTask(ctx, "DELETE", fmt.Sprintf("%s/snapshot/%s", path, url.PathEscape(params.Name)), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not delete snapshot")
+	}
+	return upid, nil
+}
+
+// SnapshotConfig returns the guest's config as it was when the snapshot was taken.
+// Pass it to ParseContainerConfig or ParseVMConfig depending on the guest type
+func (c *Client) SnapshotConfig(params *SnapshotRequest) (map[string]string, error) {
+	return c.SnapshotConfigContext(context.Background(), params)
+}
+
+// SnapshotConfigContext is SnapshotConfig with a context for cancellation and deadlines
+func (c *Client) SnapshotConfigContext(ctx context.Context, params *SnapshotRequest) (map[string]string, error) {
+	c.debug("Getting snapshot config", Fields{
+		"type": params.Type,
+		"node": params.Node,
+		"vmid": params.VMID,
+		"name": params.Name,
+	})
+
+	path, err := guestPath(params.Type, params.Node, params.VMID)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw json.RawMessage
+	err = c.Do(ctx, "GET", fmt.Sprintf("%s/snapshot/%s/config", path, url.PathEscape(params.Name)), nil, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get snapshot config")
+	}
+	return decodeConfigMap(raw)
+}
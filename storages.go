@@ -1,60 +1,37 @@
 package proxmox
 
 import (
+	"context"
 	"fmt"
-	"net/http"
-	"net/http/httputil"
-	"net/url"
 
 	"github.com/pkg/errors"
 )
 
-// StorageCreate will create a storage for a VM
-func (c *Client) StorageCreate(vmid, size string) error {
-	log.Debugln("Creating storage in Proxmox")
-
-	authed, err := c.VerifyTicket()
-	if err != nil {
-		return err
-	}
-
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return err
-		}
-	}
-
-	host := "example"
-	port := "example"
-	node := "example"
-	storage := "example"
-	u, err := url.Parse(fmt.Sprintf("https://%s:%s/api2/json/nodes/%s/storage/%s/content", host, port, node, storage))
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest("POST", u.String(), nil)
-	if err != nil {
-		return errors.Wrap(err, "Could not create request")
-	}
-
-	q := req.URL.Query()
-	q.Add("filename", fmt.Sprintf("vm-%s-disk-1", vmid))
-	q.Add("format", "raw")
-	q.Add("size", size+"G")
-	q.Add("vmid", vmid)
-	req.URL.RawQuery = q.Encode()
-	req.Header.Set("CSRFPreventionToken", c.CSRFToken)
+// StorageCreate will allocate a raw disk image of size GiB for a VM on a node's storage
+// and return its volume ID, e.g. local-lvm:vm-100-disk-1
+func (c *Client) StorageCreate(node, storage string, vmid, size int) (string, error) {
+	return c.StorageCreateContext(context.Background(), node, storage, vmid, size)
+}
 
-	proxmoxResp, err := c.client.Do(req)
+// StorageCreateContext is StorageCreate with a context for cancellation and deadlines
+func (c *Client) StorageCreateContext(ctx context.Context, node, storage string, vmid, size int) (string, error) {
+	c.debug("Creating storage in Proxmox", Fields{
+		"node":    node,
+		"storage": storage,
+		"vmid":    vmid,
+		"size":    size,
+	})
+
+	p := requestParams{}
+	p.setString("filename", fmt.Sprintf("vm-%d-disk-1", vmid))
+	p.setString("format", "raw")
+	p.setString("size", fmt.Sprintf("%dG", size))
+	p.setInt("vmid", vmid)
+
+	var volid string
+	err := c.Do(ctx, "POST", fmt.Sprintf("/nodes/%s/storage/%s/content", node, storage), p.values(), &volid)
 	if err != nil {
-		return errors.Wrap(err, "Could not execute request")
-	}
-	if proxmoxResp.StatusCode != http.StatusOK {
-		d, _ := httputil.DumpResponse(proxmoxResp, true)
-		log.Errorln(string(d))
-		err := fmt.Sprintf("Could not create container: %s", proxmoxResp.Status)
-		return errors.New(err)
+		return "", errors.Wrap(err, "Could not create storage")
 	}
-	return nil
+	return volid, nil
 }
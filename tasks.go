@@ -0,0 +1,257 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UPID is the unique ID of a Proxmox worker task, returned by every asynchronous operation.
+// It has the form UPID:node:pid:pstart:starttime:type:id:user: with the numbers in hex
+type UPID struct {
+	Node      string
+	PID       int
+	PStart    int
+	StartTime time.Time
+	Type      string
+	ID        string
+	User      string
+
+	raw string
+}
+
+// ParseUPID will convert a proxmox UPID string into a struct
+func ParseUPID(upid string) (*UPID, error) {
+	parts := strings.Split(upid, ":")
+	if len(parts) < 8 || parts[0] != "UPID" {
+		return nil, fmt.Errorf("invalid UPID: %q", upid)
+	}
+
+	pid, err := strconv.ParseInt(parts[2], 16, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pid in UPID %q", upid)
+	}
+	pstart, err := strconv.ParseInt(parts[3], 16, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pstart in UPID %q", upid)
+	}
+	starttime, err := strconv.ParseInt(parts[4], 16, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid starttime in UPID %q", upid)
+	}
+
+	result := &UPID{
+		Node:      parts[1],
+		PID:       int(pid),
+		PStart:    int(pstart),
+		StartTime: time.Unix(starttime, 0),
+		Type:      parts[5],
+		ID:        parts[6],
+		User:      strings.TrimSuffix(strings.Join(parts[7:], ":"), ":"),
+		raw:       upid,
+	}
+	return result, nil
+}
+
+// String returns the UPID as Proxmox formats it
+func (u *UPID) String() string {
+	return u.raw
+}
+
+// TaskStatus is the response from the Proxmox API for a task's status
+type TaskStatus struct {
+	Status     string `json:"status"`
+	ExitStatus string `json:"exitstatus"`
+	Node       string `json:"node"`
+	PID        int    `json:"pid"`
+	PStart     int    `json:"pstart"`
+	StartTime  int64  `json:"starttime"`
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	User       string `json:"user"`
+	UPID       string `json:"upid"`
+}
+
+// Running returns true until the task has stopped
+func (ts *TaskStatus) Running() bool {
+	return ts.Status == "running"
+}
+
+// Failed returns true if the task stopped with anything other than OK or warnings
+func (ts *TaskStatus) Failed() bool {
+	if ts.Running() {
+		return false
+	}
+	return ts.ExitStatus != "OK" && !strings.HasPrefix(ts.ExitStatus, "WARNINGS")
+}
+
+// TaskError is returned by WaitForTask when the task did not finish successfully
+type TaskError struct {
+	UPID       *UPID
+	ExitStatus string
+}
+
+// Error returns the task type, ID and exit status
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("task %s %s on %s failed: %s", e.UPID.Type, e.UPID.ID, e.UPID.Node, e.ExitStatus)
+}
+
+// TaskStatus returns the status of a worker task
+func (c *Client) TaskStatus(upid *UPID) (*TaskStatus, error) {
+	return c.TaskStatusContext(context.Background(), upid)
+}
+
+// TaskStatusContext is TaskStatus with a context for cancellation and deadlines
+func (c *Client) TaskStatusContext(ctx context.Context, upid *UPID) (*TaskStatus, error) {
+	c.debug("Getting task status", Fields{
+		"upid": upid.String(),
+	})
+
+	result := &TaskStatus{}
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/tasks/%s/status", upid.Node, url.PathEscape(upid.String())), nil, result)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get task status")
+	}
+	return result, nil
+}
+
+// defaultPollInterval is how often tasks are polled when the caller gives no interval
+const defaultPollInterval = time.Second
+
+// newPollTicker returns a ticker for the poll interval, or for defaultPollInterval when it is not positive
+func newPollTicker(pollInterval time.Duration) *time.Ticker {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	return time.NewTicker(pollInterval)
+}
+
+// WaitForTask polls the task's status every pollInterval until it stops or ctx is done.
+// A pollInterval of zero or less polls every second.
+// A task that stops with a failed exit status is reported as a *TaskError
+func (c *Client) WaitForTask(ctx context.Context, upid *UPID, pollInterval time.Duration) (*TaskStatus, error) {
+	ticker := newPollTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.TaskStatusContext(ctx, upid)
+		if err != nil {
+			return nil, err
+		}
+
+		if !status.Running() {
+			if status.Failed() {
+				return status, &TaskError{UPID: upid, ExitStatus: status.ExitStatus}
+			}
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// TaskLogLine is a single line of a task's log
+type TaskLogLine struct {
+	N int    `json:"n"`
+	T string `json:"t"`
+}
+
+// taskLogPageSize is how many lines TaskLogReader asks for at a time
+const taskLogPageSize = 500
+
+// taskLogPlaceholder is the text of the line Proxmox returns when there are no lines to read
+const taskLogPlaceholder = "no content"
+
+// TaskLog returns up to limit lines of the task's log, starting at line offset start
+func (c *Client) TaskLog(upid *UPID, start, limit int) ([]*TaskLogLine, error) {
+	return c.TaskLogContext(context.Background(), upid, start, limit)
+}
+
+// TaskLogContext is TaskLog with a context for cancellation and deadlines
+func (c *Client) TaskLogContext(ctx context.Context, upid *UPID, start, limit int) ([]*TaskLogLine, error) {
+	params := url.Values{
+		"start": []string{strconv.Itoa(start)},
+		"limit": []string{strconv.Itoa(limit)},
+	}
+
+	var result []*TaskLogLine
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/tasks/%s/log", upid.Node, url.PathEscape(upid.String())), params, &result)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get task log")
+	}
+	return result, nil
+}
+
+// TaskLogReader tails the task's log, polling every pollInterval, and returns it as a stream of
+// newline terminated lines. The stream ends with io.EOF once the task has stopped and the whole
+// log has been read. Close the reader to stop tailing early. A pollInterval of zero or less
+// polls every second
+func (c *Client) TaskLogReader(ctx context.Context, upid *UPID, pollInterval time.Duration) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.tailTaskLog(ctx, upid, pollInterval, pw))
+	}()
+	return pr
+}
+
+// tailTaskLog writes the task's log to w until the task stops, ctx is done or w is closed
+func (c *Client) tailTaskLog(ctx context.Context, upid *UPID, pollInterval time.Duration, w io.Writer) error {
+	ticker := newPollTicker(pollInterval)
+	defer ticker.Stop()
+
+	start := 0
+	stopped := false
+	for {
+		lines, err := c.TaskLogContext(ctx, upid, start, taskLogPageSize)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			// Lines are numbered from 1. When there is nothing after start Proxmox returns
+			// a placeholder numbered 1, which is either at or before start or stands in for
+			// an empty log
+			if line.N <= start || (start == 0 && len(lines) == 1 && line.N == 1 && line.T == taskLogPlaceholder) {
+				continue
+			}
+			_, err = io.WriteString(w, line.T+"\n")
+			if err != nil {
+				return err
+			}
+			start = line.N
+		}
+
+		// Keep paging without waiting while there is a backlog
+		if len(lines) == taskLogPageSize {
+			continue
+		}
+		// The log is complete once a read after the task stopped has caught up
+		if stopped {
+			return nil
+		}
+
+		status, err := c.TaskStatusContext(ctx, upid)
+		if err != nil {
+			return err
+		}
+		if !status.Running() {
+			stopped = true
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package proxmox
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+
+	"github.com/pkg/errors"
 )
 
 // Template is the values needed to create a container based on a template
@@ -20,26 +23,18 @@ type TemplateListResponse struct {
 
 // TemplateList returns a list of templates
 func (c *Client) TemplateList(node string) ([]*Template, error) {
-	log.Debugln("Getting templates from Proxmox")
-	authed, err := c.VerifyTicket()
-	if err != nil {
-		return nil, err
-	}
+	return c.TemplateListContext(context.Background(), node)
+}
 
-	if !authed {
-		err = c.SignIn()
-		if err != nil {
-			return nil, err
-		}
-	}
+// TemplateListContext is TemplateList with a context for cancellation and deadlines
+func (c *Client) TemplateListContext(ctx context.Context, node string) ([]*Template, error) {
+	c.debug("Getting templates from Proxmox", nil)
 
-	u, err := url.Parse(fmt.Sprintf(c.host+"/api2/json/nodes/%s/storage/templates/content", node))
-	proxmoxAPIResp, err := c.client.Get(u.String())
+	params := url.Values{"content": []string{"vztmpl"}}
+	var result []*Template
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/storage/%s/content", node, c.templateStorage), params, &result)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "Could not get templates")
 	}
-	proxmoxResponse := &TemplateListResponse{}
-	MustDecodeJSON(proxmoxAPIResp.Body, &proxmoxResponse)
-
-	return proxmoxResponse.Data, nil
+	return result, nil
 }
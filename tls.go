@@ -0,0 +1,101 @@
+package proxmox
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WithRootCAs trusts the given CAs instead of the system roots, e.g. the cluster's
+// own CA from /etc/pve/pve-root-ca.pem
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *Client) {
+		c.tlsConfig().RootCAs = pool
+	}
+}
+
+// WithClientCertificate presents the certificate when Proxmox or a proxy in front of it asks for one
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(c *Client) {
+		cfg := c.tlsConfig()
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+}
+
+// WithFingerprint pins the node's certificate by its SHA-256 fingerprint, as shown in the
+// Proxmox UI under the node's certificates, e.g. AB:CD:EF:... The chain is not verified
+// against any CA, so self-signed certificates work without trusting them system-wide
+func WithFingerprint(fingerprint string) Option {
+	return func(c *Client) {
+		c.fingerprint = normalizeFingerprint(fingerprint)
+	}
+}
+
+// WithInsecureSkipVerify disables certificate verification entirely. Only use it in a lab
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) {
+		c.tlsConfig().InsecureSkipVerify = true
+	}
+}
+
+// WithTransport makes the client send requests through the given RoundTripper.
+// The other TLS options have no effect, configure the transport instead
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// tlsConfig returns the TLS config the options build up, creating it on first use
+func (c *Client) tlsConfig() *tls.Config {
+	if c.tls == nil {
+		c.tls = &tls.Config{}
+	}
+	return c.tls
+}
+
+// roundTripper returns the transport for the http.Client, or nil for the default
+func (c *Client) roundTripper() http.RoundTripper {
+	if c.transport != nil {
+		return c.transport
+	}
+	if c.tls == nil && c.fingerprint == "" {
+		return nil
+	}
+
+	cfg := c.tlsConfig()
+	if c.fingerprint != "" {
+		// The pin replaces chain verification, so it must still be checked for every connection
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyFingerprint(c.fingerprint)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return transport
+}
+
+// verifyFingerprint checks that the server's leaf certificate has the pinned SHA-256 fingerprint
+func verifyFingerprint(fingerprint string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+
+		sum := sha256.Sum256(rawCerts[0])
+		got := hex.EncodeToString(sum[:])
+		if got != fingerprint {
+			return fmt.Errorf("certificate fingerprint %s does not match pinned %s", got, fingerprint)
+		}
+		return nil
+	}
+}
+
+// normalizeFingerprint turns AB:CD:EF... into abcdef... for comparison
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+}
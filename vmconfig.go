@@ -0,0 +1,559 @@
+package proxmox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// VMConfig is the response from the Proxmox API for a VM's configuration.
+// Keys the model does not know about are kept in Extra so that writing the config back is lossless
+type VMConfig struct {
+	Name        string
+	Description string
+	Tags        string
+	Digest      string
+	Ostype      string
+	Bios        string
+	Machine     string
+	Scsihw      string
+	Memory      int
+	// Balloon is the minimum memory for the balloon device. 0 disables it, nil leaves it at Memory
+	Balloon *int
+	Cores   int
+	Sockets int
+	Vcpus   int
+	// Numa and Onboot are nil when they are not set, which Proxmox treats as off
+	Numa   *bool
+	Onboot *bool
+
+	CPU      *VMCPU
+	Agent    *VMAgent
+	Boot     *VMBoot
+	Startup  *Startup
+	EFIDisk  *VMDiskConfig
+	TPMState *VMDiskConfig
+
+	// Disks are keyed by their config key, e.g. scsi0, virtio1, sata0 or ide2
+	Disks   map[string]*VMDiskConfig
+	NICs    map[int]*VMNIC
+	HostPCI map[int]*VMHostPCI
+	USB     map[int]*VMUSB
+	Serial  map[int]string
+
+	Extra map[string]string
+
+	// Delete lists keys to remove with an update, e.g. net1 or onboot. It is not part of the
+	// config Proxmox returns, and keys listed here are not sent as values
+	Delete []string
+}
+
+// vmReadOnlyKeys are keys Proxmox returns in a VM's config but rejects in an update
+var vmReadOnlyKeys = map[string]bool{
+	"meta":           true,
+	"parent":         true,
+	"snaptime":       true,
+	"vmstate":        true,
+	"runningmachine": true,
+	"runningcpu":     true,
+}
+
+var (
+	vmDiskKey  = regexp.MustCompile(`^(scsi|virtio|sata|ide)\d+$`)
+	vmIndexKey = regexp.MustCompile(`^(net|hostpci|usb|serial)(\d+)$`)
+)
+
+// ParseVMConfig builds a VMConfig from the raw config keys and values
+func ParseVMConfig(values map[string]string) (*VMConfig, error) {
+	result := &VMConfig{
+		Disks:   map[string]*VMDiskConfig{},
+		NICs:    map[int]*VMNIC{},
+		HostPCI: map[int]*VMHostPCI{},
+		USB:     map[int]*VMUSB{},
+		Serial:  map[int]string{},
+		Extra:   map[string]string{},
+	}
+
+	for key, value := range values {
+		err := result.set(key, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not parse VM config key %s", key)
+		}
+	}
+	return result, nil
+}
+
+// set parses a single config key into the model
+func (cfg *VMConfig) set(key, value string) error {
+	var err error
+	switch key {
+	case "name":
+		cfg.Name = value
+	case "description":
+		cfg.Description = value
+	case "tags":
+		cfg.Tags = value
+	case "digest":
+		cfg.Digest = value
+	case "ostype":
+		cfg.Ostype = value
+	case "bios":
+		cfg.Bios = value
+	case "machine":
+		cfg.Machine = value
+	case "scsihw":
+		cfg.Scsihw = value
+	case "memory":
+		cfg.Memory, err = strconv.Atoi(value)
+	case "balloon":
+		var balloon int
+		balloon, err = strconv.Atoi(value)
+		cfg.Balloon = &balloon
+	case "cores":
+		cfg.Cores, err = strconv.Atoi(value)
+	case "sockets":
+		cfg.Sockets, err = strconv.Atoi(value)
+	case "vcpus":
+		cfg.Vcpus, err = strconv.Atoi(value)
+	case "numa":
+		numa := parseBool(value)
+		cfg.Numa = &numa
+	case "onboot":
+		onboot := parseBool(value)
+		cfg.Onboot = &onboot
+	case "cpu":
+		cfg.CPU, err = ParseVMCPU(value)
+	case "agent":
+		cfg.Agent, err = ParseVMAgent(value)
+	case "boot":
+		cfg.Boot, err = ParseVMBoot(value)
+	case "startup":
+		cfg.Startup, err = ParseStartup(value)
+	case "efidisk0":
+		cfg.EFIDisk, err = ParseVMDiskConfig(value)
+	case "tpmstate0":
+		cfg.TPMState, err = ParseVMDiskConfig(value)
+	default:
+		if vmDiskKey.MatchString(key) {
+			cfg.Disks[key], err = ParseVMDiskConfig(value)
+			return err
+		}
+
+		match := vmIndexKey.FindStringSubmatch(key)
+		if match == nil {
+			cfg.Extra[key] = value
+			return nil
+		}
+
+		index, _ := strconv.Atoi(match[2])
+		switch match[1] {
+		case "net":
+			cfg.NICs[index], err = ParseVMNIC(value)
+		case "hostpci":
+			cfg.HostPCI[index], err = ParseVMHostPCI(value)
+		case "usb":
+			cfg.USB[index], err = ParseVMUSB(value)
+		case "serial":
+			cfg.Serial[index] = value
+		}
+	}
+	return err
+}
+
+// Map returns the config as raw keys and values, the inverse of ParseVMConfig
+func (cfg *VMConfig) Map() map[string]string {
+	result := map[string]string{}
+	for key, value := range cfg.Extra {
+		result[key] = value
+	}
+
+	ps := propertyString(result)
+	ps.setString("name", cfg.Name)
+	ps.setString("description", cfg.Description)
+	ps.setString("tags", cfg.Tags)
+	ps.setString("digest", cfg.Digest)
+	ps.setString("ostype", cfg.Ostype)
+	ps.setString("bios", cfg.Bios)
+	ps.setString("machine", cfg.Machine)
+	ps.setString("scsihw", cfg.Scsihw)
+	ps.setInt("memory", cfg.Memory)
+	if cfg.Balloon != nil {
+		result["balloon"] = strconv.Itoa(*cfg.Balloon)
+	}
+	ps.setInt("cores", cfg.Cores)
+	ps.setInt("sockets", cfg.Sockets)
+	ps.setInt("vcpus", cfg.Vcpus)
+	ps.setOptionalBool("numa", cfg.Numa)
+	ps.setOptionalBool("onboot", cfg.Onboot)
+
+	if cfg.CPU != nil {
+		result["cpu"] = cfg.CPU.String()
+	}
+	if cfg.Agent != nil {
+		result["agent"] = cfg.Agent.String()
+	}
+	if cfg.Boot != nil {
+		result["boot"] = cfg.Boot.String()
+	}
+	if cfg.Startup != nil {
+		result["startup"] = cfg.Startup.String()
+	}
+	if cfg.EFIDisk != nil {
+		result["efidisk0"] = cfg.EFIDisk.String()
+	}
+	if cfg.TPMState != nil {
+		result["tpmstate0"] = cfg.TPMState.String()
+	}
+
+	for key, disk := range cfg.Disks {
+		result[key] = disk.String()
+	}
+	for index, nic := range cfg.NICs {
+		result[fmt.Sprintf("net%d", index)] = nic.String()
+	}
+	for index, dev := range cfg.HostPCI {
+		result[fmt.Sprintf("hostpci%d", index)] = dev.String()
+	}
+	for index, dev := range cfg.USB {
+		result[fmt.Sprintf("usb%d", index)] = dev.String()
+	}
+	for index, serial := range cfg.Serial {
+		result[fmt.Sprintf("serial%d", index)] = serial
+	}
+	return result
+}
+
+// Values returns the config as parameters for a config update. Read-only keys like meta and
+// parent are left out and the keys in Delete are sent as delete
+func (cfg *VMConfig) Values() url.Values {
+	return updateValues(cfg.Map(), vmReadOnlyKeys, cfg.Delete)
+}
+
+// UnmarshalJSON decodes the config from the Proxmox API, which mixes numbers and strings
+func (cfg *VMConfig) UnmarshalJSON(data []byte) error {
+	values, err := decodeConfigMap(data)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := ParseVMConfig(values)
+	if err != nil {
+		return err
+	}
+	*cfg = *parsed
+	return nil
+}
+
+// MarshalJSON encodes the config as the raw keys and values
+func (cfg *VMConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cfg.Map())
+}
+
+// updateValues returns a guest config as update params, without the read-only keys
+// and the keys that are deleted
+func updateValues(config map[string]string, readOnly map[string]bool, deleted []string) url.Values {
+	p := requestParams{}
+	for key, value := range config {
+		if !readOnly[key] && !containsString(deleted, key) {
+			p.setString(key, value)
+		}
+	}
+	p.setList("delete", deleted, ",")
+	return p.values()
+}
+
+// decodeConfigMap decodes a guest config object into strings, keeping numbers exactly as sent
+func decodeConfigMap(data []byte) (map[string]string, error) {
+	raw := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not decode config")
+	}
+
+	result := map[string]string{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			result[key] = v
+		case json.Number:
+			result[key] = v.String()
+		case bool:
+			result[key] = formatBool(v)
+		case nil:
+		default:
+			result[key] = fmt.Sprint(v)
+		}
+	}
+	return result, nil
+}
+
+// VMDiskConfig is a disk in a VM's config, e.g. local-lvm:vm-100-disk-0,size=32G,ssd=1
+type VMDiskConfig struct {
+	// Volume is the volume ID, "none" for an empty CD drive
+	Volume    string
+	Media     string
+	Size      string
+	Format    string
+	Cache     string
+	Discard   string
+	IOThread  bool
+	SSD       bool
+	Backup    *bool
+	Replicate *bool
+	Options   map[string]string
+}
+
+// ParseVMDiskConfig will convert a proxmox disk property string into a struct
+func ParseVMDiskConfig(s string) (*VMDiskConfig, error) {
+	ps, err := parsePropertyString(s, "file")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VMDiskConfig{
+		Volume:    ps.take("file"),
+		Media:     ps.take("media"),
+		Size:      ps.take("size"),
+		Format:    ps.take("format"),
+		Cache:     ps.take("cache"),
+		Discard:   ps.take("discard"),
+		IOThread:  ps.takeBool("iothread"),
+		SSD:       ps.takeBool("ssd"),
+		Backup:    ps.takeOptionalBool("backup"),
+		Replicate: ps.takeOptionalBool("replicate"),
+		Options:   ps,
+	}
+	return result, nil
+}
+
+// String returns the disk in Proxmox's property string format
+func (d *VMDiskConfig) String() string {
+	ps := copyProperties(d.Options)
+	ps.setString("file", d.Volume)
+	ps.setString("media", d.Media)
+	ps.setString("size", d.Size)
+	ps.setString("format", d.Format)
+	ps.setString("cache", d.Cache)
+	ps.setString("discard", d.Discard)
+	ps.setBool("iothread", d.IOThread)
+	ps.setBool("ssd", d.SSD)
+	ps.setOptionalBool("backup", d.Backup)
+	ps.setOptionalBool("replicate", d.Replicate)
+	return ps.format("file")
+}
+
+// vmNICOptions are the keys of a NIC that are not its model
+var vmNICOptions = map[string]bool{
+	"model": true, "macaddr": true, "bridge": true, "tag": true, "firewall": true,
+	"link_down": true, "mtu": true, "queues": true, "rate": true, "trunks": true,
+}
+
+// ParseVMNIC will convert a proxmox network device property string into a struct.
+// Proxmox writes the model as the key of the MAC address, e.g. virtio=BC:24:11:00:00:01,bridge=vmbr0
+func ParseVMNIC(s string) (*VMNIC, error) {
+	ps, err := parsePropertyString(s, "model")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VMNIC{
+		Model: ps.take("model"),
+		MAC:   ps.take("macaddr"),
+	}
+	for key, value := range ps {
+		if !vmNICOptions[key] {
+			result.Model = key
+			result.MAC = value
+			delete(ps, key)
+			break
+		}
+	}
+
+	result.Bridge = ps.take("bridge")
+	result.Firewall = ps.takeBool("firewall")
+	result.LinkDown = ps.takeBool("link_down")
+	result.Rate = ps.take("rate")
+	result.Trunks = ps.take("trunks")
+	result.Tag, err = ps.takeInt("tag")
+	if err != nil {
+		return nil, err
+	}
+	result.MTU, err = ps.takeInt("mtu")
+	if err != nil {
+		return nil, err
+	}
+	result.Queues, err = ps.takeInt("queues")
+	if err != nil {
+		return nil, err
+	}
+	result.Options = ps
+	return result, nil
+}
+
+// VMCPU is the CPU type and flags of a VM, e.g. host,flags=+aes
+type VMCPU struct {
+	Type    string
+	Flags   string
+	Options map[string]string
+}
+
+// ParseVMCPU will convert a proxmox cpu property string into a struct
+func ParseVMCPU(s string) (*VMCPU, error) {
+	ps, err := parsePropertyString(s, "cputype")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VMCPU{
+		Type:    ps.take("cputype"),
+		Flags:   ps.take("flags"),
+		Options: ps,
+	}
+	return result, nil
+}
+
+// String returns the CPU in Proxmox's property string format
+func (cpu *VMCPU) String() string {
+	ps := copyProperties(cpu.Options)
+	ps.setString("cputype", cpu.Type)
+	ps.setString("flags", cpu.Flags)
+	return ps.format("cputype")
+}
+
+// VMAgent is the QEMU guest agent setting of a VM, e.g. 1,fstrim_cloned_disks=1
+type VMAgent struct {
+	Enabled bool
+	Type    string
+	Options map[string]string
+}
+
+// ParseVMAgent will convert a proxmox agent property string into a struct
+func ParseVMAgent(s string) (*VMAgent, error) {
+	ps, err := parsePropertyString(s, "enabled")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VMAgent{
+		Enabled: ps.takeBool("enabled"),
+		Type:    ps.take("type"),
+		Options: ps,
+	}
+	return result, nil
+}
+
+// String returns the agent setting in Proxmox's property string format
+func (a *VMAgent) String() string {
+	ps := copyProperties(a.Options)
+	ps["enabled"] = formatBool(a.Enabled)
+	ps.setString("type", a.Type)
+	return ps.format("enabled")
+}
+
+// VMBoot is the boot order of a VM, e.g. order=scsi0;ide2;net0
+type VMBoot struct {
+	Order []string
+	// Legacy is the pre 6.2 boot order of drive letters, e.g. cdn
+	Legacy  string
+	Options map[string]string
+}
+
+// ParseVMBoot will convert a proxmox boot property string into a struct
+func ParseVMBoot(s string) (*VMBoot, error) {
+	ps, err := parsePropertyString(s, "legacy")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VMBoot{
+		Legacy: ps.take("legacy"),
+	}
+	if order := ps.take("order"); order != "" {
+		result.Order = strings.Split(order, ";")
+	}
+	result.Options = ps
+	return result, nil
+}
+
+// String returns the boot order in Proxmox's property string format
+func (b *VMBoot) String() string {
+	ps := copyProperties(b.Options)
+	ps.setString("legacy", b.Legacy)
+	ps.setString("order", strings.Join(b.Order, ";"))
+	return ps.format("legacy")
+}
+
+// VMHostPCI is a PCI device passed through to a VM, e.g. 0000:01:00.0,pcie=1,x-vga=1
+type VMHostPCI struct {
+	Host    string
+	PCIe    bool
+	XVGA    bool
+	ROMBar  *bool
+	Options map[string]string
+}
+
+// ParseVMHostPCI will convert a proxmox hostpci property string into a struct
+func ParseVMHostPCI(s string) (*VMHostPCI, error) {
+	ps, err := parsePropertyString(s, "host")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VMHostPCI{
+		Host:    ps.take("host"),
+		PCIe:    ps.takeBool("pcie"),
+		XVGA:    ps.takeBool("x-vga"),
+		ROMBar:  ps.takeOptionalBool("rombar"),
+		Options: ps,
+	}
+	return result, nil
+}
+
+// String returns the PCI device in Proxmox's property string format
+func (dev *VMHostPCI) String() string {
+	ps := copyProperties(dev.Options)
+	ps.setString("host", dev.Host)
+	ps.setBool("pcie", dev.PCIe)
+	ps.setBool("x-vga", dev.XVGA)
+	ps.setOptionalBool("rombar", dev.ROMBar)
+	return ps.format("host")
+}
+
+// VMUSB is a USB device passed through to a VM, e.g. host=1234:5678,usb3=1
+type VMUSB struct {
+	Host    string
+	USB3    bool
+	Options map[string]string
+}
+
+// ParseVMUSB will convert a proxmox usb property string into a struct
+func ParseVMUSB(s string) (*VMUSB, error) {
+	ps, err := parsePropertyString(s, "host")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VMUSB{
+		Host:    ps.take("host"),
+		USB3:    ps.takeBool("usb3"),
+		Options: ps,
+	}
+	return result, nil
+}
+
+// String returns the USB device in Proxmox's property string format
+func (dev *VMUSB) String() string {
+	ps := copyProperties(dev.Options)
+	ps.setString("host", dev.Host)
+	ps.setBool("usb3", dev.USB3)
+	// Proxmox writes the host key by name even though it may be left out
+	return ps.format("")
+}
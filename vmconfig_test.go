@@ -0,0 +1,183 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestVMConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name: "debian server",
+			config: `{
+				"boot": "order=scsi0;ide2;net0",
+				"cores": 2,
+				"cpu": "x86-64-v2-AES",
+				"digest": "5b1f9e2c0d7c4a3b2f6e8d9c1a0b7e6f5d4c3b2a",
+				"ide2": "local:iso/debian-12.5.0-amd64-netinst.iso,media=cdrom,size=629M",
+				"memory": "2048",
+				"meta": "creation-qemu=8.1.5,ctime=1712345678",
+				"name": "web-1",
+				"net0": "virtio=BC:24:11:2E:C2:4A,bridge=vmbr0,firewall=1",
+				"numa": 0,
+				"onboot": 1,
+				"ostype": "l26",
+				"scsi0": "local-lvm:vm-100-disk-0,iothread=1,size=32G",
+				"scsihw": "virtio-scsi-single",
+				"smbios1": "uuid=6c2b4a8e-7f1d-4c3b-9a2e-5d6f7a8b9c0d",
+				"sockets": 1,
+				"vmgenid": "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"
+			}`,
+		},
+		{
+			name: "explicit off flags",
+			config: `{
+				"agent": "0",
+				"balloon": 0,
+				"memory": "4096",
+				"net0": "virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=0,link_down=0",
+				"numa": 0,
+				"onboot": 0,
+				"scsi0": "local-lvm:vm-101-disk-0,backup=0,iothread=0,size=32G,ssd=0"
+			}`,
+		},
+		{
+			name: "windows with efi, tpm and passthrough",
+			config: `{
+				"agent": "1,fstrim_cloned_disks=1",
+				"bios": "ovmf",
+				"boot": "order=sata0;net0",
+				"cores": 8,
+				"cpu": "host,flags=+aes",
+				"efidisk0": "local-lvm:vm-102-disk-0,efitype=4m,pre-enrolled-keys=1,size=4M",
+				"hostpci0": "0000:01:00,pcie=1,x-vga=1",
+				"machine": "pc-q35-8.1",
+				"memory": "16384",
+				"net0": "e1000=BC:24:11:00:00:02,bridge=vmbr1,tag=20",
+				"ostype": "win11",
+				"sata0": "local-lvm:vm-102-disk-1,cache=writeback,discard=on,size=128G",
+				"serial0": "socket",
+				"startup": "order=2,up=30",
+				"tpmstate0": "local-lvm:vm-102-disk-2,size=4M,version=v2.0",
+				"usb0": "host=046d:c52b,usb3=1"
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertConfigRoundTrip(t, tt.config, &VMConfig{})
+		})
+	}
+}
+
+// configMapper is a guest config model that decodes from the API's JSON
+type configMapper interface {
+	json.Unmarshaler
+	Map() map[string]string
+}
+
+// assertConfigRoundTrip decodes the config JSON into cfg and checks that Map gives back every key unchanged
+func assertConfigRoundTrip(t *testing.T, config string, cfg configMapper) {
+	t.Helper()
+
+	want, err := decodeConfigMap([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal([]byte(config), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertConfigMap(t, cfg.Map(), want)
+}
+
+// assertConfigMap reports every key that differs between the raw configs
+func assertConfigMap(t *testing.T, got, want map[string]string) {
+	t.Helper()
+
+	if reflect.DeepEqual(got, want) {
+		return
+	}
+	for key := range want {
+		if got[key] != want[key] {
+			t.Errorf("%s: got %q, want %q", key, got[key], want[key])
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("%s: got %q, want nothing", key, got[key])
+		}
+	}
+}
+
+func TestVMConfigUpdateTurnsFlagsOff(t *testing.T) {
+	cfg, err := ParseVMConfig(map[string]string{"numa": "1", "onboot": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	off := false
+	cfg.Numa = &off
+	cfg.Onboot = &off
+
+	values := cfg.Values()
+	if values.Get("numa") != "0" || values.Get("onboot") != "0" {
+		t.Errorf("got numa=%q onboot=%q, want both 0", values.Get("numa"), values.Get("onboot"))
+	}
+}
+
+func TestVMConfigValuesSkipsReadOnlyKeys(t *testing.T) {
+	cfg, err := ParseVMConfig(map[string]string{
+		"digest":         "5b1f9e2c0d7c4a3b2f6e8d9c1a0b7e6f5d4c3b2a",
+		"memory":         "2048",
+		"meta":           "creation-qemu=8.1.5,ctime=1712345678",
+		"parent":         "before-upgrade",
+		"runningmachine": "pc-i440fx-8.1+pve0",
+		"vmgenid":        "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := cfg.Values()
+	for _, key := range []string{"meta", "parent", "runningmachine"} {
+		if _, ok := values[key]; ok {
+			t.Errorf("got %s=%q, want it left out", key, values.Get(key))
+		}
+	}
+	for _, key := range []string{"digest", "memory", "vmgenid"} {
+		if _, ok := values[key]; !ok {
+			t.Errorf("got no %s, want it sent", key)
+		}
+	}
+}
+
+func TestVMConfigValuesDeletesKeys(t *testing.T) {
+	cfg, err := ParseVMConfig(map[string]string{
+		"memory": "2048",
+		"net0":   "virtio=BC:24:11:2E:C2:4A,bridge=vmbr0",
+		"net1":   "virtio=BC:24:11:2E:C2:4B,bridge=vmbr1",
+		"onboot": "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Onboot = nil
+	cfg.Delete = []string{"net1", "onboot"}
+
+	values := cfg.Values()
+	if values.Get("delete") != "net1,onboot" {
+		t.Errorf("got delete=%q, want net1,onboot", values.Get("delete"))
+	}
+	for _, key := range []string{"net1", "onboot"} {
+		if _, ok := values[key]; ok {
+			t.Errorf("got %s=%q, want it only deleted", key, values.Get(key))
+		}
+	}
+}
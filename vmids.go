@@ -0,0 +1,194 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The range of VMIDs Proxmox accepts
+const (
+	minVMID = 100
+	maxVMID = 999999999
+)
+
+// vmidCreateAttempts is how many IDs VMIDAllocator.Create tries before it gives up
+const vmidCreateAttempts = 5
+
+// VMIDAvailable returns true if no guest in the cluster uses the VMID
+func (c *Client) VMIDAvailable(vmid int) (bool, error) {
+	return c.VMIDAvailableContext(context.Background(), vmid)
+}
+
+// VMIDAvailableContext is VMIDAvailable with a context for cancellation and deadlines
+func (c *Client) VMIDAvailableContext(ctx context.Context, vmid int) (bool, error) {
+	c.debug("Checking if ID is available", Fields{
+		"vmid": vmid,
+	})
+
+	p := requestParams{}
+	p.setInt("vmid", vmid)
+
+	var result string
+	err := c.Do(ctx, "GET", "/cluster/nextid", p.values(), &result)
+	if IsConflict(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "Could not check ID")
+	}
+	return true, nil
+}
+
+// VMIDAllocator hands out VMIDs from a range, such as the range of one tenant. IDs it has
+// handed out stay reserved until they are released, so concurrent callers sharing an
+// allocator never get the same ID. Callers in other processes can still take an ID first,
+// which Create handles by retrying with the next one. It is safe for concurrent use
+type VMIDAllocator struct {
+	client *Client
+	min    int
+	max    int
+
+	mu       sync.Mutex
+	reserved map[int]bool
+}
+
+// NewVMIDAllocator returns an allocator for the IDs from min to max inclusive.
+// Zero for either uses the lowest or highest ID Proxmox accepts
+func NewVMIDAllocator(client *Client, min, max int) (*VMIDAllocator, error) {
+	if min == 0 {
+		min = minVMID
+	}
+	if max == 0 {
+		max = maxVMID
+	}
+	if min < minVMID || max > maxVMID || min > max {
+		return nil, fmt.Errorf("invalid VMID range %d-%d, must be within %d-%d", min, max, minVMID, maxVMID)
+	}
+
+	result := &VMIDAllocator{
+		client:   client,
+		min:      min,
+		max:      max,
+		reserved: map[int]bool{},
+	}
+	return result, nil
+}
+
+// Reserve returns the lowest ID in the range that is neither used in the cluster nor reserved.
+// Release it once the task creating the guest has finished or creating it failed. Until the
+// task has written the guest's config the cluster still reports the ID as free
+func (a *VMIDAllocator) Reserve(ctx context.Context) (int, error) {
+	resources, err := a.client.ResourceListContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	used := map[int]bool{}
+	for _, resource := range resources {
+		if resource.Type == "lxc" || resource.Type == "qemu" {
+			used[resource.Vmid] = true
+		}
+	}
+
+	for {
+		vmid, err := a.reserveUnused(used)
+		if err != nil {
+			return 0, err
+		}
+
+		// The resource list can be behind a guest that is being created right now.
+		// The ID is already reserved, so the check runs without holding the lock
+		available, err := a.client.VMIDAvailableContext(ctx, vmid)
+		if err != nil {
+			a.Release(vmid)
+			return 0, err
+		}
+		if available {
+			return vmid, nil
+		}
+		a.Release(vmid)
+		used[vmid] = true
+	}
+}
+
+// reserveUnused reserves the lowest ID in the range that is neither used nor reserved
+func (a *VMIDAllocator) reserveUnused(used map[int]bool) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for vmid := a.min; vmid <= a.max; vmid++ {
+		if used[vmid] || a.reserved[vmid] {
+			continue
+		}
+		a.reserved[vmid] = true
+		return vmid, nil
+	}
+	return 0, fmt.Errorf("no free VMID in range %d-%d", a.min, a.max)
+}
+
+// ReserveID reserves an ID the caller chose. It fails if the ID is outside the range,
+// already reserved or used in the cluster
+func (a *VMIDAllocator) ReserveID(ctx context.Context, vmid int) error {
+	if vmid < a.min || vmid > a.max {
+		return fmt.Errorf("VMID %d is outside range %d-%d", vmid, a.min, a.max)
+	}
+
+	a.mu.Lock()
+	if a.reserved[vmid] {
+		a.mu.Unlock()
+		return fmt.Errorf("VMID %d is already reserved", vmid)
+	}
+	a.reserved[vmid] = true
+	a.mu.Unlock()
+
+	available, err := a.client.VMIDAvailableContext(ctx, vmid)
+	if err != nil {
+		a.Release(vmid)
+		return err
+	}
+	if !available {
+		a.Release(vmid)
+		return fmt.Errorf("VMID %d is already in use", vmid)
+	}
+	return nil
+}
+
+// Release makes a reserved ID available to Reserve again
+func (a *VMIDAllocator) Release(vmid int) {
+	a.mu.Lock()
+	delete(a.reserved, vmid)
+	a.mu.Unlock()
+}
+
+// Create reserves an ID and passes it to create, e.g. a call to ContainerCreate. If create fails
+// because a guest with the ID already exists, it is retried with another ID. create only
+// starts the task that creates the guest, so the ID it succeeded with stays reserved. Call
+// the returned release func once the task has finished, e.g. after WaitForTask
+func (a *VMIDAllocator) Create(ctx context.Context, create func(vmid int) error) (int, func(), error) {
+	var lastErr error
+	for attempt := 0; attempt < vmidCreateAttempts; attempt++ {
+		vmid, err := a.Reserve(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		err = create(vmid)
+		if err == nil {
+			return vmid, func() { a.Release(vmid) }, nil
+		}
+		// Keep IDs that turned out to be taken reserved, in case the cluster is slow to list them
+		defer a.Release(vmid)
+		if !IsConflict(err) {
+			return 0, nil, err
+		}
+
+		a.client.debug("ID was taken, retrying with another", Fields{
+			"vmid":  vmid,
+			"error": err,
+		})
+		lastErr = err
+	}
+	return 0, nil, errors.Wrapf(lastErr, "Could not create guest after %d attempts", vmidCreateAttempts)
+}
@@ -0,0 +1,222 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeCluster serves the resource list and nextid check for the guests it knows about.
+// Guests that are only created are taken but not listed yet, like a guest whose create
+// task has not written its config
+type fakeCluster struct {
+	mu      sync.Mutex
+	listed  map[int]bool
+	created map[int]bool
+}
+
+// newFakeCluster returns a cluster that lists guests with the IDs
+func newFakeCluster(listed ...int) *fakeCluster {
+	result := &fakeCluster{listed: map[int]bool{}, created: map[int]bool{}}
+	for _, vmid := range listed {
+		result.listed[vmid] = true
+	}
+	return result
+}
+
+// create marks the ID as taken, and fails with the error Proxmox gives if it already was
+func (f *fakeCluster) create(vmid int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.listed[vmid] || f.created[vmid] {
+		return &APIError{StatusCode: http.StatusInternalServerError, Message: fmt.Sprintf("unable to create CT %d - CT %d already exists on node 'pve1'", vmid, vmid)}
+	}
+	f.created[vmid] = true
+	return nil
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api2/json/cluster/resources":
+		resources := Resources{{Type: "node", Node: "pve1", Status: "online"}}
+		for vmid := range f.listed {
+			resources = append(resources, &Resource{Type: "lxc", Node: "pve1", Vmid: vmid})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": resources})
+	case "/api2/json/cluster/nextid":
+		vmid, _ := strconv.Atoi(r.URL.Query().Get("vmid"))
+		if f.listed[vmid] || f.created[vmid] {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"data":null,"errors":{"vmid":"VM %d already exists"}}`, vmid)
+			return
+		}
+		fmt.Fprintf(w, `{"data":"%d"}`, vmid)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTestAllocator returns an allocator for the range backed by the fake cluster
+func newTestAllocator(t *testing.T, cluster *fakeCluster, min, max int) *VMIDAllocator {
+	t.Helper()
+
+	allocator, err := NewVMIDAllocator(newTestClient(t, cluster.ServeHTTP), min, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return allocator
+}
+
+func TestVMIDAllocatorReserveConcurrently(t *testing.T) {
+	cluster := newFakeCluster(100, 101)
+	cluster.created[102] = true
+	allocator := newTestAllocator(t, cluster, 100, 199)
+
+	const workers = 20
+	ids := make(chan int, workers)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vmid, err := allocator.Reserve(context.Background())
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- vmid
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+	seen := map[int]bool{}
+	for vmid := range ids {
+		if seen[vmid] {
+			t.Errorf("got %d twice", vmid)
+		}
+		if vmid < 103 || vmid > 199 {
+			t.Errorf("got %d, want an unused ID from 103-199", vmid)
+		}
+		seen[vmid] = true
+	}
+	if len(seen) != workers {
+		t.Errorf("got %d IDs, want %d", len(seen), workers)
+	}
+}
+
+func TestVMIDAllocatorReserveExhausted(t *testing.T) {
+	allocator := newTestAllocator(t, newFakeCluster(100), 100, 101)
+
+	_, err := allocator.Reserve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = allocator.Reserve(context.Background())
+	if err == nil {
+		t.Fatal("got no error, want the range to be exhausted")
+	}
+}
+
+func TestVMIDAllocatorReserveID(t *testing.T) {
+	cluster := newFakeCluster(150)
+	cluster.created[151] = true
+	allocator := newTestAllocator(t, cluster, 100, 199)
+
+	err := allocator.ReserveID(context.Background(), 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		vmid int
+	}{
+		{name: "below range", vmid: 99},
+		{name: "above range", vmid: 200},
+		{name: "already reserved", vmid: 120},
+		{name: "listed in cluster", vmid: 150},
+		{name: "being created in cluster", vmid: 151},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := allocator.ReserveID(context.Background(), tt.vmid)
+			if err == nil {
+				t.Errorf("got no error reserving %d", tt.vmid)
+			}
+		})
+	}
+
+	// IDs that failed the cluster check must not stay reserved
+	if allocator.isReserved(150) || allocator.isReserved(151) {
+		t.Error("got taken IDs left reserved")
+	}
+}
+
+func TestVMIDAllocatorCreate(t *testing.T) {
+	cluster := newFakeCluster()
+	allocator := newTestAllocator(t, cluster, 100, 199)
+
+	// Another process creates 100 between the allocator's check and its create call
+	attempts := []int{}
+	vmid, release, err := allocator.Create(context.Background(), func(vmid int) error {
+		attempts = append(attempts, vmid)
+		if vmid == 100 {
+			cluster.create(100)
+		}
+		return cluster.create(vmid)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vmid != 101 || len(attempts) != 2 {
+		t.Fatalf("got %d after attempts %v, want 101 after 100 and 101", vmid, attempts)
+	}
+
+	// The create task has not finished, so the ID must stay reserved
+	if !allocator.isReserved(101) {
+		t.Fatal("got 101 released, want it reserved until release is called")
+	}
+	release()
+	if allocator.isReserved(101) {
+		t.Error("got 101 still reserved after release")
+	}
+}
+
+// isReserved returns true if the allocator holds the ID
+func (a *VMIDAllocator) isReserved(vmid int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reserved[vmid]
+}
+
+func TestVMIDAllocatorCreateFails(t *testing.T) {
+	allocator := newTestAllocator(t, newFakeCluster(), 100, 199)
+
+	_, _, err := allocator.Create(context.Background(), func(vmid int) error {
+		return &APIError{StatusCode: http.StatusForbidden, Message: "Permission check failed"}
+	})
+	if !IsForbidden(err) {
+		t.Fatalf("got %v, want the create error", err)
+	}
+
+	allocator.mu.Lock()
+	defer allocator.mu.Unlock()
+	if len(allocator.reserved) > 0 {
+		t.Errorf("got %v reserved after a failed create, want none", allocator.reserved)
+	}
+}
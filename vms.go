@@ -0,0 +1,300 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// VMCreateRequest is a request to the Proxmox API to create a qemu VM
+type VMCreateRequest struct {
+	Node        string
+	VMID        int
+	Name        string
+	Description string
+	Cores       int
+	Sockets     int
+	Memory      int
+	Disks       []*VMDisk
+	NICs        []*VMNIC
+	// ISO is the volume ID of an installer ISO, e.g. local:iso/debian-12.iso, attached as ide2
+	ISO string
+	// BootOrder lists devices by key, e.g. scsi0, ide2, net0. Defaults to Proxmox's own order
+	BootOrder []string
+	OSType    string
+	BIOS      string
+	Machine   string
+	SCSIHW    string
+}
+
+// VMDisk is a disk to allocate for a new VM
+type VMDisk struct {
+	// Bus is one of scsi, virtio, sata or ide. Disks are numbered in order on each bus
+	Bus string
+	// Storage defaults to the client's VM storage
+	Storage string
+	// Size is in GiB
+	Size     int
+	Format   string
+	Cache    string
+	Discard  bool
+	IOThread bool
+	SSD      bool
+}
+
+// String returns the disk in Proxmox's property string format
+func (d *VMDisk) String() string {
+	opts := []string{fmt.Sprintf("%s:%d", d.Storage, d.Size)}
+	if d.Format != "" {
+		opts = append(opts, "format="+d.Format)
+	}
+	if d.Cache != "" {
+		opts = append(opts, "cache="+d.Cache)
+	}
+	if d.Discard {
+		opts = append(opts, "discard=on")
+	}
+	if d.IOThread {
+		opts = append(opts, "iothread=1")
+	}
+	if d.SSD {
+		opts = append(opts, "ssd=1")
+	}
+	return strings.Join(opts, ",")
+}
+
+// VMNIC is a network device of a VM
+type VMNIC struct {
+	// Model is one of virtio, e1000, rtl8139 or vmxnet3
+	Model string
+	MAC   string
+	// Bridge defaults to the client's default bridge, and so does Tag when the bridge is
+	// defaulted and Tag is 0
+	Bridge   string
+	Tag      int
+	Firewall bool
+	LinkDown bool
+	MTU      int
+	Queues   int
+	// Rate is the rate limit in MB/s
+	Rate    string
+	Trunks  string
+	Options map[string]string
+}
+
+// String returns the NIC in Proxmox's property string format
+func (n *VMNIC) String() string {
+	model := n.Model
+	if model == "" {
+		model = "virtio"
+	}
+	if n.MAC != "" {
+		model += "=" + n.MAC
+	}
+
+	ps := copyProperties(n.Options)
+	ps.setString("bridge", n.Bridge)
+	ps.setInt("tag", n.Tag)
+	ps.setBool("firewall", n.Firewall)
+	ps.setBool("link_down", n.LinkDown)
+	ps.setInt("mtu", n.MTU)
+	ps.setInt("queues", n.Queues)
+	ps.setString("rate", n.Rate)
+	ps.setString("trunks", n.Trunks)
+	if len(ps) == 0 {
+		return model
+	}
+	return model + "," + ps.format("")
+}
+
+// VMConfigRequest is a request to the Proxmox API for a VM's configuration
+type VMConfigRequest struct {
+	Node string
+	VMID int
+}
+
+// VMConfig returns the VM config
+func (c *Client) VMConfig(params *VMConfigRequest) (*VMConfig, error) {
+	return c.VMConfigContext(context.Background(), params)
+}
+
+// VMConfigContext is VMConfig with a context for cancellation and deadlines
+func (c *Client) VMConfigContext(ctx context.Context, params *VMConfigRequest) (*VMConfig, error) {
+	c.debug("Getting VM config", Fields{
+		"node": params.Node,
+		"vmid": params.VMID,
+	})
+
+	result := &VMConfig{}
+	err := c.Do(ctx, "GET", fmt.Sprintf("/nodes/%s/qemu/%d/config", params.Node, params.VMID), nil, result)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get VM config")
+	}
+	return result, nil
+}
+
+// VMUpdate writes the whole config back to the VM, except for read-only keys, and removes the
+// keys in the config's Delete. The config's Digest makes the update fail if the config was
+// changed since it was read
+func (c *Client) VMUpdate(node string, vmid int, config *VMConfig) error {
+	return c.VMUpdateContext(context.Background(), node, vmid, config)
+}
+
+// VMUpdateContext is VMUpdate with a context for cancellation and deadlines
+func (c *Client) VMUpdateContext(ctx context.Context, node string, vmid int, config *VMConfig) error {
+	c.debug("Updating VM config", Fields{
+		"node":   node,
+		"vmid":   vmid,
+		"delete": config.Delete,
+	})
+
+	err := c.Do(ctx, "PUT", fmt.Sprintf("/nodes/%s/qemu/%d/config", node, vmid), config.Values(), nil)
+	if err != nil {
+		return errors.Wrap(err, "Could not update VM config")
+	}
+	return nil
+}
+
+// VMCreate runs the Create action for the Proxmox VMs
+func (c *Client) VMCreate(params *VMCreateRequest) (*UPID, error) {
+	return c.VMCreateContext(context.Background(), params)
+}
+
+// VMCreateContext is VMCreate with a context for cancellation and deadlines
+func (c *Client) VMCreateContext(ctx context.Context, params *VMCreateRequest) (*UPID, error) {
+	c.debug("Creating VM", Fields{
+		"Node":    params.Node,
+		"VMID":    params.VMID,
+		"Name":    params.Name,
+		"Cores":   params.Cores,
+		"Sockets": params.Sockets,
+		"Memory":  params.Memory,
+		"ISO":     params.ISO,
+	})
+
+	p := requestParams{}
+	p.setInt("vmid", params.VMID)
+	p.setString("name", params.Name)
+	p.setString("description", params.Description)
+	p.setInt("cores", params.Cores)
+	p.setInt("sockets", params.Sockets)
+	p.setInt("memory", params.Memory)
+	p.setString("ostype", params.OSType)
+	p.setString("bios", params.BIOS)
+	p.setString("machine", params.Machine)
+	p.setString("scsihw", params.SCSIHW)
+
+	busIndex := map[string]int{}
+	for _, disk := range params.Disks {
+		withDefaults := *disk
+		if withDefaults.Storage == "" {
+			withDefaults.Storage = c.vmStorage
+		}
+		p.setString(fmt.Sprintf("%s%d", disk.Bus, busIndex[disk.Bus]), withDefaults.String())
+		busIndex[disk.Bus]++
+	}
+	for i, nic := range params.NICs {
+		withDefaults := *nic
+		if withDefaults.Bridge == "" {
+			withDefaults.Bridge = c.defaultBridge
+			if withDefaults.Tag == 0 {
+				withDefaults.Tag = c.defaultTag
+			}
+		}
+		p.setString(fmt.Sprintf("net%d", i), withDefaults.String())
+	}
+	if params.ISO != "" {
+		p.setString("ide2", params.ISO+",media=cdrom")
+	}
+	if len(params.BootOrder) > 0 {
+		p.setString("boot", "order="+strings.Join(params.BootOrder, ";"))
+	}
+
+	upid, err := c.doTask(ctx, "POST", fmt.Sprintf("/nodes/%s/qemu", params.Node), p.values())
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create VM")
+	}
+	return upid, nil
+}
+
+// VMDelete runs the Delete action for the Proxmox VMs
+func (c *Client) VMDelete(node string, vmid int) (*UPID, error) {
+	return c.VMDeleteContext(context.Background(), node, vmid)
+}
+
+// VMDeleteContext is VMDelete with a context for cancellation and deadlines
+func (c *Client) VMDeleteContext(ctx context.Context, node string, vmid int) (*UPID, error) {
+	c.debug("Deleting VM", Fields{
+		"node": node,
+		"vmid": strconv.Itoa(vmid),
+	})
+
+	upid, err := c.doTask(ctx, "DELETE", fmt.Sprintf("/nodes/%s/qemu/%d", node, vmid), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not delete VM")
+	}
+	return upid, nil
+}
+
+// VMStop will stop the VM immediately, like pulling the power
+func (c *Client) VMStop(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.VMStopContext(context.Background(), params)
+}
+
+// VMStopContext is VMStop with a context for cancellation and deadlines
+func (c *Client) VMStopContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "stop", params.Node, params.VMID, "qemu")
+}
+
+// VMStart will start the VM
+func (c *Client) VMStart(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.VMStartContext(context.Background(), params)
+}
+
+// VMStartContext is VMStart with a context for cancellation and deadlines
+func (c *Client) VMStartContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "start", params.Node, params.VMID, "qemu")
+}
+
+// VMShutdown will ask the guest OS to shut down via ACPI
+func (c *Client) VMShutdown(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.VMShutdownContext(context.Background(), params)
+}
+
+// VMShutdownContext is VMShutdown with a context for cancellation and deadlines
+func (c *Client) VMShutdownContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "shutdown", params.Node, params.VMID, "qemu")
+}
+
+// VMResume will resume a suspended VM
+func (c *Client) VMResume(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.VMResumeContext(context.Background(), params)
+}
+
+// VMResumeContext is VMResume with a context for cancellation and deadlines
+func (c *Client) VMResumeContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "resume", params.Node, params.VMID, "qemu")
+}
+
+// VMSuspend will pause the VM
+func (c *Client) VMSuspend(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.VMSuspendContext(context.Background(), params)
+}
+
+// VMSuspendContext is VMSuspend with a context for cancellation and deadlines
+func (c *Client) VMSuspendContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "suspend", params.Node, params.VMID, "qemu")
+}
+
+// VMReset will reset the VM, like pressing the reset button
+func (c *Client) VMReset(params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.VMResetContext(context.Background(), params)
+}
+
+// VMResetContext is VMReset with a context for cancellation and deadlines
+func (c *Client) VMResetContext(ctx context.Context, params *ContainerVMStatusRequest) (*UPID, error) {
+	return c.vmStatusPOSTHelper(ctx, "reset", params.Node, params.VMID, "qemu")
+}